@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/redis/go-redis/v9"
+	"go.yaml.in/yaml/v3"
+)
+
+// errInvalidIssuer is returned when an issuer configuration is not valid.
+var errInvalidIssuer = errors.New("invalid issuer")
+
+// issuersConfig is the configuration of additional token issuers, e.g. identity provider tenants.
+type issuersConfig struct {
+	// Issuers are the issuer configurations by name.
+	Issuers map[string]*issuerConfig `yaml:"issuers"`
+}
+
+// issuerConfig is the configuration of a token issuer. Issuers are configured like the default
+// issuer given in the command-line arguments, and use the same token validation method.
+type issuerConfig struct {
+	// OIDCIssuerURL is the issuer URL for OIDC discovery.
+	OIDCIssuerURL string `yaml:"oidc_issuer_url"`
+	// IntrospectionEndpoint is the token introspection endpoint.
+	IntrospectionEndpoint string `yaml:"introspection_endpoint"`
+	// ClientID is the client ID for the token introspection endpoint.
+	ClientID string `yaml:"client_id"`
+	// ClientSecret is the client secret for the token introspection endpoint.
+	ClientSecret string `yaml:"client_secret"`
+	// ClientSecretFile is a file containing the client secret.
+	ClientSecretFile string `yaml:"client_secret_file"`
+	// ClientAuthMethod is the client authentication method (defaults to the best supported method).
+	ClientAuthMethod string `yaml:"client_auth_method"`
+	// ClientPrivateKeyFile is a file containing the private key for private_key_jwt.
+	ClientPrivateKeyFile string `yaml:"client_private_key_file"`
+	// ClientKeyID is the key ID of the private key for private_key_jwt.
+	ClientKeyID string `yaml:"client_key_id"`
+	// Hosts are the request hosts served by the issuer. A leading "*." matches any subdomain.
+	Hosts []string `yaml:"hosts"`
+}
+
+// loadIssuers reads an issuers configuration from a YAML (or JSON) file.
+func loadIssuers(name string) (*issuersConfig, error) {
+	file, err := os.Open(name) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+
+	var cfg issuersConfig
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("YAML decoder: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// newIssuers creates the issuers configured in the issuers file, ordered by name.
+func newIssuers(
+	ctx context.Context,
+	args args,
+	clnt *http.Client,
+	rdb *redis.Client,
+	revs client.RevocationStore,
+) ([]*client.Issuer, error) {
+	icfg, err := loadIssuers(args.IssuersFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading issuers from file: %w", err)
+	}
+
+	issuers := make([]*client.Issuer, 0, len(icfg.Issuers))
+
+	for _, name := range slices.Sorted(maps.Keys(icfg.Issuers)) {
+		iss, err := newIssuer(ctx, args, clnt, rdb, revs, name, icfg.Issuers[name])
+		if err != nil {
+			return nil, fmt.Errorf("issuer %q: %w", name, err)
+		}
+
+		slog.Info("issuer loaded", "name", name, "issuer", iss.Identifier, "hosts", iss.Hosts)
+		issuers = append(issuers, iss)
+	}
+
+	return issuers, nil
+}
+
+// newIssuer creates an issuer with its own discovery, client credentials and cache, using the
+// command-line arguments for any other settings.
+func newIssuer(
+	ctx context.Context,
+	args args,
+	clnt *http.Client,
+	rdb *redis.Client,
+	revs client.RevocationStore,
+	name string,
+	cfg *issuerConfig,
+) (*client.Issuer, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("%w: empty configuration", errInvalidIssuer)
+	}
+
+	iargs := args
+	iargs.OIDCIssuerURL = nil
+	iargs.IntrospectionEndpoint = nil
+	iargs.ClientID = cfg.ClientID
+	iargs.ClientSecret = cfg.ClientSecret
+	iargs.ClientAuthMethod = cfg.ClientAuthMethod
+	iargs.ClientPrivateKeyFile = cfg.ClientPrivateKeyFile
+	iargs.ClientKeyID = cfg.ClientKeyID
+	iargs.CacheRedisPrefix = args.CacheRedisPrefix + name + ":"
+
+	var err error
+
+	if cfg.OIDCIssuerURL != "" {
+		iargs.OIDCIssuerURL, err = url.ParseRequestURI(cfg.OIDCIssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC issuer URL: %w", err)
+		}
+	}
+
+	if cfg.IntrospectionEndpoint != "" {
+		iargs.IntrospectionEndpoint, err = url.ParseRequestURI(cfg.IntrospectionEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("introspection endpoint: %w", err)
+		}
+	}
+
+	if cfg.ClientSecretFile != "" {
+		data, err := os.ReadFile(cfg.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client secret from file: %w", err)
+		}
+
+		iargs.ClientSecret = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if err := validateIssuer(iargs); err != nil {
+		return nil, err
+	}
+
+	var odr *client.OIDCDiscoveryResponse
+
+	if iargs.OIDCIssuerURL != nil {
+		if odr, err = discover(ctx, iargs, clnt); err != nil {
+			return nil, err
+		}
+	}
+
+	isrv, err := newIntrospector(ctx, iargs, name, clnt, odr, rdb, revs)
+	if err != nil {
+		return nil, fmt.Errorf("new introspector: %w", err)
+	}
+
+	iss := &client.Issuer{
+		Name:         name,
+		Identifier:   "",
+		Hosts:        cfg.Hosts,
+		Introspector: isrv,
+	}
+
+	if odr != nil {
+		iss.Identifier = issuer(iargs, odr)
+	}
+
+	return iss, nil
+}
+
+// validateIssuer checks that the issuer settings in the arguments are complete for the
+// token validation method.
+func validateIssuer(args args) error {
+	if args.TokenValidation != tokenValidationJWT {
+		if args.OIDCIssuerURL == nil && args.IntrospectionEndpoint == nil {
+			return fmt.Errorf("%w: either oidc_issuer_url or introspection_endpoint is required",
+				errInvalidIssuer)
+		}
+
+		if args.ClientID == "" {
+			return fmt.Errorf("%w: client_id is required for token introspection", errInvalidIssuer)
+		}
+
+		if args.ClientSecret == "" && args.ClientPrivateKeyFile == "" &&
+			args.ClientTLSCertFile == "" {
+			return fmt.Errorf(
+				"%w: either client_secret, client_secret_file, client_private_key_file or "+
+					"--client-tls-cert-file is required",
+				errInvalidIssuer,
+			)
+		}
+	}
+
+	if args.TokenValidation != tokenValidationIntrospection && args.OIDCIssuerURL == nil {
+		return fmt.Errorf("%w: oidc_issuer_url is required for JWT validation", errInvalidIssuer)
+	}
+
+	return nil
+}
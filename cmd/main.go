@@ -5,9 +5,13 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
@@ -21,20 +25,87 @@ import (
 	"github.com/hhromic/traefik-fwdauth/v2/internal/buildinfo"
 	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
 	_ "github.com/hhromic/traefik-fwdauth/v2/internal/metrics" // initialize collectors
+	"github.com/hhromic/traefik-fwdauth/v2/internal/policy"
 	"github.com/hhromic/traefik-fwdauth/v2/internal/server"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/session"
+	"github.com/redis/go-redis/v9"
 )
 
 //nolint:lll,tagalign
 type args struct {
-	ListenAddress         string          `arg:"--listen-address,env:LISTEN_ADDRESS" default:":4181" placeholder:"ADDRESS" help:"listen address for the HTTP server"`
-	OIDCIssuerURL         *url.URL        `arg:"--oidc-issuer-url,env:OIDC_ISSUER_URL" placeholder:"URL" help:"issuer URL for OIDC discovery"`
-	IntrospectionEndpoint *url.URL        `arg:"--introspection-endpoint,env:INTROSPECTION_ENDPOINT" placeholder:"URL" help:"token introspection endpoint"`
-	ClientID              string          `arg:"--client-id,required,env:CLIENT_ID" placeholder:"CLIENT_ID" help:"client ID for the token introspection endpoint"`
-	ClientSecret          string          `arg:"--client-secret,env:CLIENT_SECRET" placeholder:"CLIENT_SECRET" help:"client secret for the token introspection endpoint"`
-	ClientSecretFile      string          `arg:"--client-secret-file,env:CLIENT_SECRET_FILE" placeholder:"FILE" help:"file containing the client secret"`
-	ExpireAfter           time.Duration   `arg:"--expire-after,env:EXPIRE_AFTER" default:"5m" placeholder:"DURATION" help:"time for expiring cached client requests"`
-	LogHandler            slogkit.Handler `arg:"--log-handler,env:LOG_HANDLER" default:"auto" placeholder:"HANDLER" help:"application logging handler"`
-	LogLevel              slog.Level      `arg:"--log-level,env:LOG_LEVEL" default:"info" placeholder:"LEVEL" help:"application logging level"`
+	ListenAddress             string            `arg:"--listen-address,env:LISTEN_ADDRESS" default:":4181" placeholder:"ADDRESS" help:"listen address for the HTTP server"`
+	OIDCIssuerURL             *url.URL          `arg:"--oidc-issuer-url,env:OIDC_ISSUER_URL" placeholder:"URL" help:"issuer URL for OIDC discovery"`
+	IntrospectionEndpoint     *url.URL          `arg:"--introspection-endpoint,env:INTROSPECTION_ENDPOINT" placeholder:"URL" help:"token introspection endpoint"`
+	ClientID                  string            `arg:"--client-id,env:CLIENT_ID" placeholder:"CLIENT_ID" help:"client ID for the token introspection endpoint"`
+	ClientSecret              string            `arg:"--client-secret,env:CLIENT_SECRET" placeholder:"CLIENT_SECRET" help:"client secret for the token introspection endpoint"`
+	ClientSecretFile          string            `arg:"--client-secret-file,env:CLIENT_SECRET_FILE" placeholder:"FILE" help:"file containing the client secret"`
+	ClientAuthMethod          string            `arg:"--client-auth-method,env:CLIENT_AUTH_METHOD" placeholder:"METHOD" help:"client authentication method for the identity provider (client_secret_basic, client_secret_post, client_secret_jwt or private_key_jwt; defaults to the best supported method)"`
+	ClientPrivateKeyFile      string            `arg:"--client-private-key-file,env:CLIENT_PRIVATE_KEY_FILE" placeholder:"FILE" help:"file containing the PEM-encoded private key for private_key_jwt client authentication"`
+	ClientKeyID               string            `arg:"--client-key-id,env:CLIENT_KEY_ID" placeholder:"KID" help:"key ID of the private key for private_key_jwt client authentication"`
+	ClientTLSCertFile         string            `arg:"--client-tls-cert-file,env:CLIENT_TLS_CERT_FILE" placeholder:"FILE" help:"file containing the PEM-encoded client certificate for mutual TLS with the identity provider"`
+	ClientTLSKeyFile          string            `arg:"--client-tls-key-file,env:CLIENT_TLS_KEY_FILE" placeholder:"FILE" help:"file containing the PEM-encoded private key of the client certificate"`
+	ClientTLSCAFile           string            `arg:"--client-tls-ca-file,env:CLIENT_TLS_CA_FILE" placeholder:"FILE" help:"file containing the PEM-encoded certificate authorities for verifying identity provider certificates (defaults to the system trust store)"`
+	ClientTLSMinVersion       string            `arg:"--client-tls-min-version,env:CLIENT_TLS_MIN_VERSION" default:"1.2" placeholder:"VERSION" help:"minimum TLS version for the identity provider (1.2 or 1.3)"`
+	ClientTLSPins             []string          `arg:"--client-tls-pin,separate,env:CLIENT_TLS_PINS" placeholder:"PIN" help:"base64-encoded SHA-256 hash of the subject public key info of an identity provider certificate or CA to pin (can be repeated)"`
+	ClientProxyURL            *url.URL          `arg:"--client-proxy-url,env:CLIENT_PROXY_URL" placeholder:"URL" help:"HTTP(S) proxy for the identity provider (defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables)"`
+	ClientMaxIdleConns        int               `arg:"--client-max-idle-conns,env:CLIENT_MAX_IDLE_CONNS" default:"100" placeholder:"NUM" help:"maximum number of idle connections to the identity provider"`
+	ClientMaxIdleConnsPerHost int               `arg:"--client-max-idle-conns-per-host,env:CLIENT_MAX_IDLE_CONNS_PER_HOST" default:"2" placeholder:"NUM" help:"maximum number of idle connections per identity provider host"`
+	ClientMaxConnsPerHost     int               `arg:"--client-max-conns-per-host,env:CLIENT_MAX_CONNS_PER_HOST" default:"0" placeholder:"NUM" help:"maximum number of connections per identity provider host (0 for no limit)"`
+	ClientRetryMaxAttempts    int               `arg:"--client-retry-max-attempts,env:CLIENT_RETRY_MAX_ATTEMPTS" default:"3" placeholder:"NUM" help:"maximum number of attempts for discovery and introspection requests to the identity provider (1 disables retries)"`
+	ClientRetryBaseDelay      time.Duration     `arg:"--client-retry-base-delay,env:CLIENT_RETRY_BASE_DELAY" default:"200ms" placeholder:"DURATION" help:"maximum delay before the first retry, doubled for each further retry"`
+	ClientRetryMaxDelay       time.Duration     `arg:"--client-retry-max-delay,env:CLIENT_RETRY_MAX_DELAY" default:"5s" placeholder:"DURATION" help:"maximum delay between retries, including delays requested with Retry-After"`
+	CircuitBreakerFailures    int               `arg:"--circuit-breaker-failures,env:CIRCUIT_BREAKER_FAILURES" default:"5" placeholder:"NUM" help:"number of consecutive failed introspection requests opening the circuit breaker (0 disables the circuit breaker)"`
+	CircuitBreakerOpenTimeout time.Duration     `arg:"--circuit-breaker-open-timeout,env:CIRCUIT_BREAKER_OPEN_TIMEOUT" default:"30s" placeholder:"DURATION" help:"time for failing introspection requests fast before probing the introspection endpoint again"`
+	IssuersFile               string            `arg:"--issuers-file,env:ISSUERS_FILE" placeholder:"FILE" help:"file containing additional token issuers (YAML or JSON)"`
+	Realm                     string            `arg:"--realm,env:REALM" default:"traefik-fwdauth" placeholder:"REALM" help:"realm for authentication challenges in WWW-Authenticate response headers"`
+	Audiences                 []string          `arg:"--audience,separate,env:AUDIENCE" placeholder:"AUDIENCE" help:"allowed token audience when not provided in auth requests (can be repeated)"`
+	ClaimHeaders              map[string]string `arg:"--claim-header,separate,env:CLAIM_HEADERS" placeholder:"CLAIM=HEADER" help:"response header to set with the value of a token claim (can be repeated)"`
+	ClaimHeaderFormat         string            `arg:"--claim-header-format,env:CLAIM_HEADER_FORMAT" default:"csv" placeholder:"FORMAT" help:"format for array and object claim values in headers (csv, space or json)"`
+	PolicyFile                string            `arg:"--policy-file,env:POLICY_FILE" placeholder:"FILE" help:"file containing authorization policies (YAML or JSON)"`
+	ExpireAfter               time.Duration     `arg:"--expire-after,env:EXPIRE_AFTER" default:"5m" placeholder:"DURATION" help:"time for expiring cached active introspection results (capped at the token expiration time)"`
+	ExpireAfterInactive       time.Duration     `arg:"--expire-after-inactive,env:EXPIRE_AFTER_INACTIVE" default:"5m" placeholder:"DURATION" help:"time for expiring cached inactive introspection results"`
+	ExpireAfterError          time.Duration     `arg:"--expire-after-error,env:EXPIRE_AFTER_ERROR" default:"0s" placeholder:"DURATION" help:"time for expiring cached introspection errors (0 disables caching errors)"`
+	CacheRedisURL             string            `arg:"--cache-redis-url,env:CACHE_REDIS_URL" placeholder:"URL" help:"Redis protocol server URL for sharing cached introspection results (e.g. redis://host:6379/0)"`
+	CacheRedisPrefix          string            `arg:"--cache-redis-prefix,env:CACHE_REDIS_PREFIX" default:"fwdauth:introspection:" placeholder:"PREFIX" help:"key prefix for cached introspection results in the Redis protocol server"`
+	CacheRedisRevPrefix       string            `arg:"--cache-redis-revocation-prefix,env:CACHE_REDIS_REVOCATION_PREFIX" default:"fwdauth:revocation:" placeholder:"PREFIX" help:"key prefix for session revocations in the Redis protocol server"`
+	CacheKeySecret            string            `arg:"--cache-key-secret,env:CACHE_KEY_SECRET" placeholder:"SECRET" help:"secret key for hashing tokens in cache keys (random if not provided)"`
+	CacheKeySecretFile        string            `arg:"--cache-key-secret-file,env:CACHE_KEY_SECRET_FILE" placeholder:"FILE" help:"file containing the secret key for hashing tokens in cache keys"`
+	TokenValidation           string            `arg:"--token-validation,env:TOKEN_VALIDATION" default:"introspection" placeholder:"METHOD" help:"token validation method (introspection, jwt or jwt+introspection)"`
+	JWKSRefreshInterval       time.Duration     `arg:"--jwks-refresh-interval,env:JWKS_REFRESH_INTERVAL" default:"1m" placeholder:"DURATION" help:"minimum time between refreshes of the JWKS for unknown key IDs"`
+	JWTLeeway                 time.Duration     `arg:"--jwt-leeway,env:JWT_LEEWAY" default:"30s" placeholder:"DURATION" help:"leeway for validating JWT time claims"`
+	JWTSkipTypeCheck          bool              `arg:"--jwt-skip-type-check,env:JWT_SKIP_TYPE_CHECK" help:"accept JWT access tokens without the at+jwt type header, for issuers that do not set it"`
+	DPoPProofMaxAge           time.Duration     `arg:"--dpop-proof-max-age,env:DPOP_PROOF_MAX_AGE" default:"1m" placeholder:"DURATION" help:"maximum age of DPoP proofs for DPoP-bound tokens"`
+	DPoPReplayCacheSize       int               `arg:"--dpop-replay-cache-size,env:DPOP_REPLAY_CACHE_SIZE" default:"100000" placeholder:"SIZE" help:"maximum number of remembered DPoP proofs for detecting replays"`
+	LoginRedirectURL          *url.URL          `arg:"--login-redirect-url,env:LOGIN_REDIRECT_URL" placeholder:"URL" help:"callback URL for browser logins, absolute or relative to the original request URL (enables browser logins)"`
+	LoginScopes               []string          `arg:"--login-scope,separate,env:LOGIN_SCOPES" placeholder:"SCOPE" help:"scope to request for browser logins (can be repeated, defaults to openid)"`
+	LoginCookieName           string            `arg:"--login-cookie-name,env:LOGIN_COOKIE_NAME" default:"_fwdauth_session" placeholder:"NAME" help:"name of the session cookie for browser logins"`
+	LoginCookieDomain         string            `arg:"--login-cookie-domain,env:LOGIN_COOKIE_DOMAIN" placeholder:"DOMAIN" help:"domain of the session cookie for browser logins (defaults to the request host)"`
+	LoginCookieSecret         string            `arg:"--login-cookie-secret,env:LOGIN_COOKIE_SECRET" placeholder:"SECRET" help:"secret key for encrypting session cookies for browser logins (at least 32 bytes)"`
+	LoginCookieSecretFile     string            `arg:"--login-cookie-secret-file,env:LOGIN_COOKIE_SECRET_FILE" placeholder:"FILE" help:"file containing the secret key for encrypting session cookies"`
+	LoginRefreshBefore        time.Duration     `arg:"--login-refresh-before,env:LOGIN_REFRESH_BEFORE" default:"1m" placeholder:"DURATION" help:"time before the access token expiration for refreshing sessions using refresh tokens"`
+	LoginPostLogoutURL        *url.URL          `arg:"--login-post-logout-redirect-url,env:LOGIN_POST_LOGOUT_REDIRECT_URL" placeholder:"URL" help:"URL to redirect users to after logging out, absolute or relative to the logout request URL"`
+	LogoutRetention           time.Duration     `arg:"--logout-retention,env:LOGOUT_RETENTION" default:"24h" placeholder:"DURATION" help:"time for remembering logged out sessions (should exceed the session lifetime)"`
+	LogHandler                slogkit.Handler   `arg:"--log-handler,env:LOG_HANDLER" default:"auto" placeholder:"HANDLER" help:"application logging handler"`
+	LogLevel                  slog.Level        `arg:"--log-level,env:LOG_LEVEL" default:"info" placeholder:"LEVEL" help:"application logging level"`
+}
+
+// Token validation methods.
+const (
+	tokenValidationIntrospection    = "introspection"
+	tokenValidationJWT              = "jwt"
+	tokenValidationJWTIntrospection = "jwt+introspection"
+)
+
+// defaultIssuerName is the name of the default issuer given in the command-line arguments,
+// as used in metrics.
+const defaultIssuerName = "default"
+
+// tlsVersions are the supported minimum TLS versions.
+//
+//nolint:gochecknoglobals
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
 }
 
 func (args) Description() string {
@@ -50,12 +121,107 @@ func main() {
 
 	parser := arg.MustParse(&args)
 
-	if args.OIDCIssuerURL == nil && args.IntrospectionEndpoint == nil {
-		parser.Fail("either --oidc-issuer-url or --introspection-endpoint is required")
+	hasDefaultIssuer := args.OIDCIssuerURL != nil || args.IntrospectionEndpoint != nil
+
+	if !hasDefaultIssuer && args.IssuersFile == "" {
+		parser.Fail(
+			"either --oidc-issuer-url, --introspection-endpoint or --issuers-file is required",
+		)
+	}
+
+	switch args.TokenValidation {
+	case tokenValidationIntrospection, tokenValidationJWTIntrospection:
+		if !hasDefaultIssuer {
+			break
+		}
+
+		if args.ClientID == "" {
+			parser.Fail("--client-id is required for token introspection")
+		}
+
+		if args.ClientSecret == "" && args.ClientSecretFile == "" &&
+			args.ClientPrivateKeyFile == "" && args.ClientTLSCertFile == "" {
+			parser.Fail("either --client-secret, --client-secret-file, --client-private-key-file " +
+				"or --client-tls-cert-file is required")
+		}
+	case tokenValidationJWT:
+	default:
+		parser.Fail("unsupported token validation method: " + args.TokenValidation)
+	}
+
+	switch args.ClientAuthMethod {
+	case "", client.ClientAuthMethodSecretBasic, client.ClientAuthMethodSecretPost,
+		client.ClientAuthMethodSecretJWT, client.ClientAuthMethodPrivateKeyJWT,
+		client.ClientAuthMethodTLSClientAuth:
+	default:
+		parser.Fail("unsupported client authentication method: " + args.ClientAuthMethod)
+	}
+
+	if (args.ClientTLSCertFile == "") != (args.ClientTLSKeyFile == "") {
+		parser.Fail(
+			"both --client-tls-cert-file and --client-tls-key-file are required for mutual TLS",
+		)
+	}
+
+	if args.CircuitBreakerFailures < 0 {
+		parser.Fail("--circuit-breaker-failures must not be negative")
+	}
+
+	if args.ClientRetryMaxAttempts < 1 {
+		parser.Fail("--client-retry-max-attempts must be positive")
+	}
+
+	if _, ok := tlsVersions[args.ClientTLSMinVersion]; !ok {
+		parser.Fail("unsupported TLS version: " + args.ClientTLSMinVersion)
+	}
+
+	for _, pin := range args.ClientTLSPins {
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(hash) != sha256.Size {
+			parser.Fail("invalid TLS pin: " + pin)
+		}
+	}
+
+	switch args.ClaimHeaderFormat {
+	case server.ClaimHeaderFormatCSV, server.ClaimHeaderFormatSpace, server.ClaimHeaderFormatJSON:
+	default:
+		parser.Fail("unsupported claim header format: " + args.ClaimHeaderFormat)
+	}
+
+	if args.DPoPReplayCacheSize < 1 {
+		parser.Fail("--dpop-replay-cache-size must be positive")
+	}
+
+	if args.CacheRedisURL != "" && args.CacheKeySecret == "" && args.CacheKeySecretFile == "" {
+		parser.Fail("either --cache-key-secret or --cache-key-secret-file is required for " +
+			"--cache-redis-url")
 	}
 
-	if args.ClientSecret == "" && args.ClientSecretFile == "" {
-		parser.Fail("either --client-secret or --client-secret-file is required")
+	if hasDefaultIssuer && args.TokenValidation != tokenValidationIntrospection &&
+		args.OIDCIssuerURL == nil {
+		parser.Fail("--oidc-issuer-url is required for JWT validation")
+	}
+
+	if args.LoginRedirectURL != nil {
+		if args.OIDCIssuerURL == nil {
+			parser.Fail("--oidc-issuer-url is required for browser logins")
+		}
+
+		if args.ClientID == "" {
+			parser.Fail("--client-id is required for browser logins")
+		}
+
+		if args.LoginCookieSecret == "" && args.LoginCookieSecretFile == "" {
+			parser.Fail("either --login-cookie-secret or --login-cookie-secret-file is required " +
+				"for browser logins")
+		}
+
+		if args.LoginCookieSecret != "" && len(args.LoginCookieSecret) < session.MinSecretSize {
+			parser.Fail(fmt.Sprintf(
+				"--login-cookie-secret must be at least %d bytes",
+				session.MinSecretSize,
+			))
+		}
 	}
 
 	slog.SetDefault(slogkit.NewLogger(os.Stderr, args.LogHandler, args.LogLevel))
@@ -85,39 +251,148 @@ func appMain(args args) error {
 		args.ClientSecret = strings.TrimRight(string(data), "\r\n")
 	}
 
+	if args.CacheKeySecretFile != "" {
+		data, err := os.ReadFile(args.CacheKeySecretFile)
+		if err != nil {
+			return fmt.Errorf("error reading cache key secret from file: %w", err)
+		}
+
+		args.CacheKeySecret = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if args.LoginCookieSecretFile != "" {
+		data, err := os.ReadFile(args.LoginCookieSecretFile)
+		if err != nil {
+			return fmt.Errorf("error reading login cookie secret from file: %w", err)
+		}
+
+		args.LoginCookieSecret = strings.TrimRight(string(data), "\r\n")
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	clnt := client.NewClient()
+	ccfg := &client.ClientConfig{ //nolint:exhaustruct
+		MinVersion:          tlsVersions[args.ClientTLSMinVersion],
+		Pins:                args.ClientTLSPins,
+		Proxy:               args.ClientProxyURL,
+		MaxIdleConns:        args.ClientMaxIdleConns,
+		MaxIdleConnsPerHost: args.ClientMaxIdleConnsPerHost,
+		MaxConnsPerHost:     args.ClientMaxConnsPerHost,
+	}
+
+	if args.ClientTLSCAFile != "" {
+		pool, err := client.LoadCertPool(args.ClientTLSCAFile)
+		if err != nil {
+			return fmt.Errorf("error loading certificate authorities: %w", err)
+		}
+
+		ccfg.RootCAs = pool
+	}
+
+	if args.ClientTLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(args.ClientTLSCertFile, args.ClientTLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("error loading client certificate: %w", err)
+		}
+
+		ccfg.Certificates = []tls.Certificate{cert}
+	}
+
+	clnt := client.NewClient(ccfg)
+
+	var odr *client.OIDCDiscoveryResponse
+
+	var (
+		rdb *redis.Client
+		err error
+	)
 
 	if args.OIDCIssuerURL != nil {
-		ds := &client.OIDCDiscoveryService{
-			Client:    clnt,
-			IssuerURL: *args.OIDCIssuerURL,
+		odr, err = discover(ctx, args, clnt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if args.CacheRedisURL != "" {
+		rdb, err = newRedisClient(ctx, args)
+		if err != nil {
+			return fmt.Errorf("new Redis client: %w", err)
+		}
+	}
+
+	var (
+		revs client.RevocationStore
+		bcfg *server.BackChannelLogoutConfig
+	)
+
+	if odr != nil && args.ClientID != "" {
+		revs = newRevocationStore(ctx, args, rdb)
+
+		bcfg, err = newBackChannelLogoutConfig(args, clnt, odr, revs)
+		if err != nil {
+			return fmt.Errorf("new back-channel logout config: %w", err)
 		}
+	}
 
-		endpoint, err := ds.DiscoverIntrospection(ctx)
+	router := &client.IssuerRouter{} //nolint:exhaustruct
+
+	if args.OIDCIssuerURL != nil || args.IntrospectionEndpoint != nil {
+		router.Default, err = newIntrospector(ctx, args, defaultIssuerName, clnt, odr, rdb, revs)
 		if err != nil {
-			return fmt.Errorf("OIDC discovery failed: %w", err)
+			return fmt.Errorf("new introspector: %w", err)
 		}
+	}
 
-		slog.Info("OIDC discovery completed", "introspection_endpoint", endpoint)
-		args.IntrospectionEndpoint = endpoint
+	if args.IssuersFile != "" {
+		router.Issuers, err = newIssuers(ctx, args, clnt, rdb, revs)
+		if err != nil {
+			return fmt.Errorf("new issuers: %w", err)
+		}
 	}
 
-	isrv := &client.IntrospectionService{
-		Client:       clnt,
-		URL:          *args.IntrospectionEndpoint,
-		ClientID:     args.ClientID,
-		ClientSecret: args.ClientSecret,
-		Cache:        client.NewIntrospectionCache(ctx, args.ExpireAfter),
+	var lcfg *server.LoginConfig
+
+	if args.LoginRedirectURL != nil {
+		lcfg, err = newLoginConfig(args, clnt, odr, revs)
+		if err != nil {
+			return fmt.Errorf("new login config: %w", err)
+		}
 	}
 
-	m := server.NewServeMux(isrv)
+	var pcfg *policy.Config
+
+	if args.PolicyFile != "" {
+		pcfg, err = policy.Load(args.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("error loading policies from file: %w", err)
+		}
+
+		slog.Info("policies loaded", "policies", len(pcfg.Policies), "rules", len(pcfg.Rules))
+	}
+
+	acfg := &server.AuthConfig{
+		Realm:             args.Realm,
+		Issuers:           router,
+		Policies:          pcfg,
+		Audiences:         args.Audiences,
+		ClaimHeaders:      args.ClaimHeaders,
+		ClaimHeaderFormat: args.ClaimHeaderFormat,
+		Login:             lcfg,
+		BackChannelLogout: bcfg,
+		DPoP: client.NewDPoPValidator(
+			args.DPoPProofMaxAge,
+			args.JWTLeeway,
+			args.DPoPReplayCacheSize,
+		),
+	}
+
+	m := server.NewServeMux(acfg)
 
 	slog.Info("starting HTTP server", "addr", args.ListenAddress)
 
-	err := server.Run(ctx, args.ListenAddress, m)
+	err = server.Run(ctx, args.ListenAddress, m)
 	if err != nil && !errors.Is(err, context.Canceled) {
 		return fmt.Errorf("run: %w", err)
 	}
@@ -126,3 +401,352 @@ func appMain(args args) error {
 
 	return nil
 }
+
+// retryPolicy returns the retry policy for discovery and introspection requests.
+func retryPolicy(args args) *client.RetryPolicy {
+	return &client.RetryPolicy{
+		MaxAttempts: args.ClientRetryMaxAttempts,
+		BaseDelay:   args.ClientRetryBaseDelay,
+		MaxDelay:    args.ClientRetryMaxDelay,
+	}
+}
+
+// discover performs OIDC discovery for the issuer URL. When using mutual TLS, the mutual TLS
+// endpoint aliases are used instead of the discovered endpoints, if any.
+func discover(
+	ctx context.Context,
+	args args,
+	clnt *http.Client,
+) (*client.OIDCDiscoveryResponse, error) {
+	ds := &client.OIDCDiscoveryService{
+		Client:    clnt,
+		IssuerURL: *args.OIDCIssuerURL,
+		Retry:     retryPolicy(args),
+	}
+
+	odr, err := ds.Discover(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	slog.Info("OIDC discovery completed", "issuer", odr.Issuer)
+
+	if args.ClientTLSCertFile != "" {
+		odr.UseMTLSEndpointAliases()
+	}
+
+	return odr, nil
+}
+
+func newIntrospector(
+	ctx context.Context,
+	args args,
+	name string,
+	clnt *http.Client,
+	odr *client.OIDCDiscoveryResponse,
+	rdb *redis.Client,
+	revs client.RevocationStore,
+) (client.Introspector, error) {
+	var isrv client.Introspector
+
+	if args.TokenValidation != tokenValidationJWT {
+		if odr != nil {
+			endpoint, err := odr.IntrospectionURL()
+			if err != nil {
+				return nil, fmt.Errorf("introspection endpoint: %w", err)
+			}
+
+			slog.Info("using introspection endpoint", "url", endpoint)
+			args.IntrospectionEndpoint = endpoint
+		}
+
+		ttl := client.IntrospectionCacheTTL{
+			Active:   args.ExpireAfter,
+			Inactive: args.ExpireAfterInactive,
+			Error:    args.ExpireAfterError,
+		}
+
+		icache := newIntrospectionCache(ctx, args, ttl, rdb)
+
+		hasher, err := client.NewTokenHasher([]byte(args.CacheKeySecret))
+		if err != nil {
+			return nil, fmt.Errorf("new token hasher: %w", err)
+		}
+
+		var supported []string
+		if odr != nil {
+			supported = odr.IntrospectionEndpointAuthMethods
+		}
+
+		auth, err := newClientAuth(args, supported)
+		if err != nil {
+			return nil, fmt.Errorf("new client auth: %w", err)
+		}
+
+		var breaker *client.CircuitBreaker
+		if args.CircuitBreakerFailures > 0 {
+			breaker = client.NewCircuitBreaker(
+				name,
+				args.CircuitBreakerFailures,
+				args.CircuitBreakerOpenTimeout,
+			)
+		}
+
+		isrv = &client.IntrospectionService{
+			Client:      clnt,
+			URL:         *args.IntrospectionEndpoint,
+			Auth:        auth,
+			Cache:       icache,
+			CacheTTL:    ttl,
+			Hasher:      hasher,
+			Revocations: revs,
+			Retry:       retryPolicy(args),
+			Breaker:     breaker,
+		}
+	}
+
+	if args.TokenValidation == tokenValidationIntrospection {
+		return isrv, nil
+	}
+
+	jwksURL, err := odr.JWKSURL()
+	if err != nil {
+		return nil, fmt.Errorf("JWKS endpoint: %w", err)
+	}
+
+	slog.Info("using JWKS endpoint", "url", jwksURL)
+
+	jwtv := &client.JWTValidator{
+		Keys: &client.JWKSService{
+			Client:          clnt,
+			URL:             *jwksURL,
+			RefreshInterval: args.JWKSRefreshInterval,
+		},
+		Issuer:        issuer(args, odr),
+		Leeway:        args.JWTLeeway,
+		SkipTypeCheck: args.JWTSkipTypeCheck,
+		Fallback:      isrv,
+		Revocations:   revs,
+	}
+
+	return jwtv, nil
+}
+
+func newLoginConfig(
+	args args,
+	clnt *http.Client,
+	odr *client.OIDCDiscoveryResponse,
+	revs client.RevocationStore,
+) (*server.LoginConfig, error) {
+	authURL, err := odr.AuthorizationURL()
+	if err != nil {
+		return nil, fmt.Errorf("authorization endpoint: %w", err)
+	}
+
+	tokenURL, err := odr.TokenURL()
+	if err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+
+	endSessionURL, err := odr.EndSessionURL()
+	if err != nil && !errors.Is(err, client.ErrDiscoveryMetadataMissing) {
+		return nil, fmt.Errorf("end session endpoint: %w", err)
+	}
+
+	slog.Info("using authorization endpoint", "url", authURL)
+	slog.Info("using token endpoint", "url", tokenURL)
+
+	if endSessionURL != nil {
+		slog.Info("using end session endpoint", "url", endSessionURL)
+	}
+
+	codec, err := session.NewCodec([]byte(args.LoginCookieSecret))
+	if err != nil {
+		return nil, fmt.Errorf("new session codec: %w", err)
+	}
+
+	scopes := args.LoginScopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	auth, err := newClientAuth(args, odr.TokenEndpointAuthMethods)
+	if err != nil {
+		return nil, fmt.Errorf("new client auth: %w", err)
+	}
+
+	lcfg := &server.LoginConfig{
+		AuthCode: &client.AuthCodeService{
+			Client:   clnt,
+			AuthURL:  *authURL,
+			TokenURL: *tokenURL,
+			ClientID: args.ClientID,
+			Auth:     auth,
+			Scopes:   scopes,
+		},
+		Codec:                 codec,
+		RedirectURL:           *args.LoginRedirectURL,
+		CookieName:            args.LoginCookieName,
+		CookieDomain:          args.LoginCookieDomain,
+		RefreshBefore:         args.LoginRefreshBefore,
+		EndSessionURL:         endSessionURL,
+		PostLogoutRedirectURL: args.LoginPostLogoutURL,
+		Revocations:           revs,
+	}
+
+	return lcfg, nil
+}
+
+func newBackChannelLogoutConfig(
+	args args,
+	clnt *http.Client,
+	odr *client.OIDCDiscoveryResponse,
+	revs client.RevocationStore,
+) (*server.BackChannelLogoutConfig, error) {
+	jwksURL, err := odr.JWKSURL()
+	if err != nil {
+		return nil, fmt.Errorf("JWKS endpoint: %w", err)
+	}
+
+	bcfg := &server.BackChannelLogoutConfig{
+		LogoutTokens: &client.LogoutTokenValidator{
+			Keys: &client.JWKSService{
+				Client:          clnt,
+				URL:             *jwksURL,
+				RefreshInterval: args.JWKSRefreshInterval,
+			},
+			Issuer:   issuer(args, odr),
+			ClientID: args.ClientID,
+			Leeway:   args.JWTLeeway,
+		},
+		Revocations: revs,
+	}
+
+	return bcfg, nil
+}
+
+// newClientAuth creates the client authentication for an endpoint supporting the given client
+// authentication methods. Unless configured, the method is selected from the supported methods
+// according to the available client credentials, preferring private keys, then client
+// certificates and then client secrets.
+func newClientAuth(args args, supported []string) (client.ClientAuth, error) {
+	var candidates []string
+
+	if args.ClientPrivateKeyFile != "" {
+		candidates = append(candidates, client.ClientAuthMethodPrivateKeyJWT)
+	}
+
+	if args.ClientTLSCertFile != "" {
+		candidates = append(candidates, client.ClientAuthMethodTLSClientAuth)
+	}
+
+	if args.ClientSecret != "" {
+		candidates = append(candidates,
+			client.ClientAuthMethodSecretBasic,
+			client.ClientAuthMethodSecretPost,
+			client.ClientAuthMethodSecretJWT,
+		)
+	}
+
+	switch {
+	case args.ClientAuthMethod != "":
+		candidates = []string{args.ClientAuthMethod}
+	case len(candidates) == 0:
+		candidates = []string{client.ClientAuthMethodNone}
+	}
+
+	method := client.SelectClientAuthMethod(supported, candidates)
+
+	slog.Info("using client authentication method", "method", method)
+
+	switch method {
+	case client.ClientAuthMethodSecretBasic:
+		return &client.ClientSecretBasic{
+			ClientID:     args.ClientID,
+			ClientSecret: args.ClientSecret,
+		}, nil
+	case client.ClientAuthMethodSecretPost:
+		return &client.ClientSecretPost{
+			ClientID:     args.ClientID,
+			ClientSecret: args.ClientSecret,
+		}, nil
+	case client.ClientAuthMethodSecretJWT:
+		return client.NewClientSecretJWT(args.ClientID, args.ClientSecret) //nolint:wrapcheck
+	case client.ClientAuthMethodPrivateKeyJWT:
+		key, err := client.LoadPrivateKey(args.ClientPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client private key: %w", err)
+		}
+
+		return client.NewPrivateKeyJWT(args.ClientID, key, args.ClientKeyID) //nolint:wrapcheck
+	case client.ClientAuthMethodTLSClientAuth:
+		return &client.ClientTLS{ClientID: args.ClientID}, nil
+	case client.ClientAuthMethodNone:
+		return &client.ClientNone{ClientID: args.ClientID}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", client.ErrUnsupportedClientAuthMethod, method)
+	}
+}
+
+func newIntrospectionCache(
+	ctx context.Context,
+	args args,
+	ttl client.IntrospectionCacheTTL,
+	rdb *redis.Client,
+) client.IntrospectionCache {
+	if rdb == nil {
+		return client.NewMemoryIntrospectionCache(ctx, ttl.Max())
+	}
+
+	rcache := &client.RedisIntrospectionCache{
+		Client: rdb,
+		Prefix: args.CacheRedisPrefix,
+	}
+
+	return rcache
+}
+
+func newRevocationStore(
+	ctx context.Context,
+	args args,
+	rdb *redis.Client,
+) client.RevocationStore {
+	if rdb == nil {
+		return client.NewMemoryRevocationStore(ctx, args.LogoutRetention)
+	}
+
+	rstore := &client.RedisRevocationStore{
+		Client:    rdb,
+		Prefix:    args.CacheRedisRevPrefix,
+		Retention: args.LogoutRetention,
+	}
+
+	return rstore
+}
+
+func newRedisClient(ctx context.Context, args args) (*redis.Client, error) {
+	opts, err := redis.ParseURL(args.CacheRedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis URL parser: %w", err)
+	}
+
+	rdb := redis.NewClient(opts)
+
+	go func() {
+		<-ctx.Done()
+		rdb.Close() //nolint:errcheck,gosec
+	}()
+
+	slog.Info("using Redis cache", "addr", opts.Addr, "db", opts.DB)
+
+	return rdb, nil
+}
+
+// issuer returns the discovered issuer identifier, or the issuer URL if not discovered.
+func issuer(args args, odr *client.OIDCDiscoveryResponse) string {
+	if odr.Issuer != "" {
+		return odr.Issuer
+	}
+
+	return args.OIDCIssuerURL.String()
+}
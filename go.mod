@@ -4,15 +4,19 @@ go 1.26.0
 
 require (
 	github.com/alexflint/go-arg v1.6.1
+	github.com/go-jose/go-jose/v4 v4.1.4
 	github.com/hhromic/go-toolkit v0.0.0-20260603214834-0e8db0abe6a2
 	github.com/prometheus/client_golang v1.23.2
+	github.com/redis/go-redis/v9 v9.9.0
 	github.com/twmb/go-cache v1.3.0
+	go.yaml.in/yaml/v3 v3.0.4
 )
 
 require (
 	github.com/alexflint/go-scalar v1.2.0 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/lmittmann/tint v1.1.3 // indirect
 	github.com/mattn/go-colorable v0.1.15 // indirect
 	github.com/mattn/go-isatty v0.0.22 // indirect
@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FormFieldClientID is the request form field used for providing a client ID.
+	FormFieldClientID = "client_id"
+	// FormFieldCode is the request form field used for providing an authorization code.
+	FormFieldCode = "code"
+	// FormFieldCodeVerifier is the request form field used for providing a PKCE code verifier.
+	FormFieldCodeVerifier = "code_verifier"
+	// FormFieldGrantType is the request form field used for providing a grant type.
+	FormFieldGrantType = "grant_type"
+	// FormFieldRedirectURI is the request form field used for providing a redirection URI.
+	FormFieldRedirectURI = "redirect_uri"
+	// FormFieldRefreshToken is the request form field used for providing a refresh token.
+	FormFieldRefreshToken = "refresh_token"
+)
+
+const (
+	// RefreshReuseInterval is the time during which the result of a refresh is reused for
+	// refreshes using the same refresh token, e.g. from requests still carrying the previous
+	// refresh token after it was rotated.
+	RefreshReuseInterval = 30 * time.Second
+)
+
+const (
+	// GrantTypeAuthorizationCode is the grant type for exchanging an authorization code.
+	GrantTypeAuthorizationCode = "authorization_code"
+	// GrantTypeRefreshToken is the grant type for refreshing tokens.
+	GrantTypeRefreshToken = "refresh_token"
+	// CodeChallengeMethodS256 is the PKCE code challenge method using SHA-256.
+	CodeChallengeMethodS256 = "S256"
+	// TokenTypeBearer is the token type for bearer tokens.
+	TokenTypeBearer = "Bearer"
+)
+
+// AuthCodeService is an OAuth 2.0 authorization code flow service for obtaining tokens
+// on behalf of users, using Proof Key for Code Exchange (RFC 7636).
+// Concurrent refreshes using the same refresh token are serialized into a single token request.
+type AuthCodeService struct {
+	Client   *http.Client
+	AuthURL  url.URL
+	TokenURL url.URL
+	ClientID string
+	Auth     ClientAuth
+	Scopes   []string
+
+	flight    flightGroup[[sha256.Size]byte, *TokenResponse]
+	mu        sync.Mutex
+	refreshed map[[sha256.Size]byte]refreshResult
+}
+
+type refreshResult struct {
+	tres    *TokenResponse
+	expires time.Time
+}
+
+// TokenResponse is a response from the token URL.
+//
+//nolint:tagliatelle
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Expiry returns the expiration time of the access token relative to a given time,
+// or the zero time if the lifetime of the access token is unknown.
+func (r *TokenResponse) Expiry(now time.Time) time.Time {
+	if r.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(time.Duration(r.ExpiresIn) * time.Second)
+}
+
+// NewCodeVerifier generates a new random PKCE code verifier.
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32) //nolint:mnd
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random read: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL for redirecting users to the authorization endpoint.
+func (s *AuthCodeService) AuthCodeURL(state, verifier, redirectURI string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set(FormFieldClientID, s.ClientID)
+	query.Set(FormFieldRedirectURI, redirectURI)
+	query.Set("scope", strings.Join(s.Scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", CodeChallengeMethodS256)
+
+	authURL := s.AuthURL
+	if authURL.RawQuery != "" {
+		authURL.RawQuery += "&"
+	}
+
+	authURL.RawQuery += query.Encode()
+
+	return authURL.String()
+}
+
+// Exchange exchanges an authorization code for tokens.
+func (s *AuthCodeService) Exchange(
+	ctx context.Context,
+	code, verifier, redirectURI string,
+) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set(FormFieldGrantType, GrantTypeAuthorizationCode)
+	form.Set(FormFieldCode, code)
+	form.Set(FormFieldCodeVerifier, verifier)
+	form.Set(FormFieldRedirectURI, redirectURI)
+
+	return s.token(ctx, form)
+}
+
+// Refresh obtains new tokens using a refresh token.
+// The result of a refresh is reused for [RefreshReuseInterval] for the same refresh token.
+func (s *AuthCodeService) Refresh(
+	ctx context.Context,
+	refreshToken string,
+) (*TokenResponse, error) {
+	key := sha256.Sum256([]byte(refreshToken))
+
+	if tres := s.refreshResult(key); tres != nil {
+		return tres, nil
+	}
+
+	return s.flight.Do(ctx, key, func(ctx context.Context) (*TokenResponse, error) {
+		if tres := s.refreshResult(key); tres != nil {
+			return tres, nil
+		}
+
+		form := url.Values{}
+		form.Set(FormFieldGrantType, GrantTypeRefreshToken)
+		form.Set(FormFieldRefreshToken, refreshToken)
+
+		tres, err := s.token(ctx, form)
+		if err != nil {
+			return nil, err
+		}
+
+		if tres.RefreshToken == "" {
+			tres.RefreshToken = refreshToken
+		}
+
+		s.setRefreshResult(key, tres)
+
+		return tres, nil
+	})
+}
+
+func (s *AuthCodeService) refreshResult(key [sha256.Size]byte) *TokenResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if res, ok := s.refreshed[key]; ok && time.Now().Before(res.expires) {
+		return res.tres
+	}
+
+	return nil
+}
+
+func (s *AuthCodeService) setRefreshResult(key [sha256.Size]byte, tres *TokenResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if s.refreshed == nil {
+		s.refreshed = make(map[[sha256.Size]byte]refreshResult)
+	}
+
+	for k, res := range s.refreshed {
+		if !now.Before(res.expires) {
+			delete(s.refreshed, k)
+		}
+	}
+
+	s.refreshed[key] = refreshResult{
+		tres:    tres,
+		expires: now.Add(RefreshReuseInterval),
+	}
+}
+
+func (s *AuthCodeService) token(ctx context.Context, form url.Values) (*TokenResponse, error) {
+	tokenURL := s.TokenURL.String()
+
+	header := http.Header{}
+	if err := s.Auth.Apply(tokenURL, form, header); err != nil {
+		return nil, fmt.Errorf("client auth: %w", err)
+	}
+
+	body := strings.NewReader(form.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	maps.Copy(req.Header, header)
+	req.Header.Set(HeaderAccept, ContentTypeJSON)
+	req.Header.Set(HeaderContentType, ContentTypeFormURLEncoded)
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("client request: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %q", ErrBadResponse, res.Status)
+	}
+
+	var tres TokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tres); err != nil {
+		return nil, fmt.Errorf("JSON decoder: %w", err)
+	}
+
+	if tres.AccessToken == "" {
+		return nil, fmt.Errorf("%w: missing access token", ErrBadResponse)
+	}
+
+	if !strings.EqualFold(tres.TokenType, TokenTypeBearer) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedTokenType, tres.TokenType)
+	}
+
+	return &tres, nil
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/metrics"
+)
+
+// CircuitState is the state of a [CircuitBreaker], as reported in metrics.
+type CircuitState int
+
+// Circuit breaker states.
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitHalfOpen lets a single probe request through.
+	CircuitHalfOpen
+	// CircuitOpen fails all requests fast.
+	CircuitOpen
+)
+
+// CircuitBreaker is a circuit breaker for requests to an unhealthy endpoint.
+//
+// The circuit opens after a number of consecutive failed requests, and requests fail fast with
+// [ErrCircuitOpen] while the circuit is open. After the open timeout, the circuit is half-open
+// and lets a single probe request through, which closes the circuit if it succeeds or opens it
+// again if it fails. Requests ended by their context are not counted as failures.
+// A nil circuit breaker lets all requests through.
+type CircuitBreaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a new [CircuitBreaker] that opens after threshold consecutive failures
+// and probes the endpoint after the open timeout. The name labels the circuit state in metrics.
+func NewCircuitBreaker(name string, threshold int, openTimeout time.Duration) *CircuitBreaker {
+	b := &CircuitBreaker{ //nolint:exhaustruct
+		name:        name,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+	}
+
+	b.setState(CircuitClosed)
+
+	return b
+}
+
+// Allow returns whether a request can be made, or [ErrCircuitOpen] if the circuit is open.
+// Allowed requests must be reported using [CircuitBreaker.Done].
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitClosed:
+		return nil
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+
+		b.setState(CircuitHalfOpen)
+	case CircuitHalfOpen:
+	}
+
+	if b.probing {
+		return ErrCircuitOpen
+	}
+
+	b.probing = true
+
+	return nil
+}
+
+// Done reports the outcome of an allowed request.
+func (b *CircuitBreaker) Done(err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == CircuitHalfOpen && b.probing
+	if probe {
+		b.probing = false
+	}
+
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.setState(CircuitClosed)
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+	case probe:
+		b.open()
+	case b.state == CircuitClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.failures = 0
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+func (b *CircuitBreaker) setState(state CircuitState) {
+	b.state = state
+
+	metrics.IntrospectionCircuitState.WithLabelValues(b.name).Set(float64(state))
+}
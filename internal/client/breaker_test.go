@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// elapse makes the open timeout of a circuit breaker elapse.
+func (b *CircuitBreaker) elapse() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.openedAt = b.openedAt.Add(-b.openTimeout)
+}
+
+func (b *CircuitBreaker) currentState() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	errFailed := errors.New("failed") //nolint:err113
+
+	// Steps either request with an outcome or, if elapse is set, let the open timeout elapse.
+	type step struct {
+		elapse    bool
+		outcome   error
+		wantAllow error
+		wantState CircuitState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			"opens after threshold",
+			[]step{
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitOpen},
+				{false, nil, ErrCircuitOpen, CircuitOpen},
+			},
+		},
+		{
+			"success resets failures",
+			[]step{
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, nil, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+			},
+		},
+		{
+			"context errors are not failures",
+			[]step{
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, context.Canceled, nil, CircuitClosed},
+				{false, context.DeadlineExceeded, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitOpen},
+			},
+		},
+		{
+			"successful probe closes",
+			[]step{
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitOpen},
+				{true, nil, nil, CircuitOpen},
+				{false, nil, nil, CircuitClosed},
+				{false, nil, nil, CircuitClosed},
+			},
+		},
+		{
+			"failed probe reopens",
+			[]step{
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitOpen},
+				{true, nil, nil, CircuitOpen},
+				{false, errFailed, nil, CircuitOpen},
+				{false, nil, ErrCircuitOpen, CircuitOpen},
+			},
+		},
+		{
+			"canceled probe allows another probe",
+			[]step{
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitClosed},
+				{false, errFailed, nil, CircuitOpen},
+				{true, nil, nil, CircuitOpen},
+				{false, context.Canceled, nil, CircuitHalfOpen},
+				{false, nil, nil, CircuitClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := NewCircuitBreaker("test", 3, time.Minute)
+
+			for idx, step := range tt.steps {
+				if step.elapse {
+					b.elapse()
+
+					continue
+				}
+
+				err := b.Allow()
+				if !errors.Is(err, step.wantAllow) {
+					t.Fatalf("step %d: got allow error %v, want %v", idx, err, step.wantAllow)
+				}
+
+				if err == nil {
+					b.Done(step.outcome)
+				}
+
+				if state := b.currentState(); state != step.wantState {
+					t.Fatalf("step %d: got state %d, want %d", idx, state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	t.Parallel()
+
+	b := NewCircuitBreaker("test", 1, time.Minute)
+
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Done(errors.New("failed")) //nolint:err113
+	b.elapse()
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("got error %v for the probe, want none", err)
+	}
+
+	if state := b.currentState(); state != CircuitHalfOpen {
+		t.Fatalf("got state %d during the probe, want %d", state, CircuitHalfOpen)
+	}
+
+	for range 3 {
+		if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("got error %v during the probe, want %v", err, ErrCircuitOpen)
+		}
+	}
+
+	b.Done(nil)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("got error %v after the probe, want none", err)
+	}
+}
+
+func TestCircuitBreakerNil(t *testing.T) {
+	t.Parallel()
+
+	var b *CircuitBreaker
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("got error %v for a nil circuit breaker, want none", err)
+	}
+
+	b.Done(errors.New("failed")) //nolint:err113
+}
@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/twmb/go-cache/cache"
+)
+
+// Introspection cache outcomes.
+const (
+	// CacheOutcomeActive is the outcome of a cached active introspection response.
+	CacheOutcomeActive = "active"
+	// CacheOutcomeInactive is the outcome of a cached inactive introspection response.
+	CacheOutcomeInactive = "inactive"
+	// CacheOutcomeError is the outcome of a cached introspection error.
+	CacheOutcomeError = "error"
+)
+
+// IntrospectionCacheKey is the key used for caching introspection requests.
+// Keys are derived from tokens and token type hints using a [TokenHasher].
+type IntrospectionCacheKey struct {
+	Digest [sha256.Size]byte
+}
+
+// TokenHasher derives cache keys from tokens using HMAC-SHA256 with a secret key,
+// so that raw tokens are never used as cache keys.
+type TokenHasher struct {
+	key []byte
+}
+
+// IntrospectionCacheEntry is a cached introspection outcome, either a response or an error.
+type IntrospectionCacheEntry struct {
+	Response *IntrospectionResponse `json:"response,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+	Created  time.Time              `json:"created"`
+	Expires  time.Time              `json:"expires"`
+}
+
+// IntrospectionCache is a cache of introspection outcomes for an [IntrospectionService].
+type IntrospectionCache interface {
+	// Get returns the cached entry for a key, or nil if there is no entry for the key.
+	Get(ctx context.Context, key IntrospectionCacheKey) (*IntrospectionCacheEntry, error)
+	// Set stores an entry for a key until the entry expires.
+	Set(ctx context.Context, key IntrospectionCacheKey, entry *IntrospectionCacheEntry) error
+}
+
+// MemoryIntrospectionCache is an in-memory [IntrospectionCache].
+type MemoryIntrospectionCache struct {
+	cache *cache.Cache[IntrospectionCacheKey, *IntrospectionCacheEntry]
+}
+
+// RedisIntrospectionCache is an [IntrospectionCache] using a server compatible with the
+// Redis protocol, e.g. Redis or Valkey, allowing cached entries to be shared across instances.
+// Entries are stored as JSON values, using keys derived from the token hashes in cache keys.
+// For sharing entries, all instances must use token hashers with the same secret key.
+type RedisIntrospectionCache struct {
+	Client *redis.Client
+	Prefix string
+}
+
+// IntrospectionCacheTTL are the times for caching introspection outcomes.
+// A zero time disables caching for the corresponding outcome.
+type IntrospectionCacheTTL struct {
+	// Active is the time for caching active introspection responses.
+	// Active responses are never cached beyond the expiration time of the token.
+	Active time.Duration
+	// Inactive is the time for caching inactive introspection responses.
+	Inactive time.Duration
+	// Error is the time for caching introspection errors.
+	Error time.Duration
+}
+
+// NewTokenHasher creates a new [TokenHasher] with a secret key.
+// If the secret key is empty, a random secret key is generated.
+func NewTokenHasher(key []byte) (*TokenHasher, error) {
+	if len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("random read: %w", err)
+		}
+	}
+
+	return &TokenHasher{key: key}, nil
+}
+
+// CacheKey derives the cache key for a token and a token type hint.
+func (h *TokenHasher) CacheKey(token, tokenTypeHint string) IntrospectionCacheKey {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(tokenTypeHint))
+	mac.Write([]byte{0})
+	mac.Write([]byte(token))
+
+	var key IntrospectionCacheKey
+	mac.Sum(key.Digest[:0])
+
+	return key
+}
+
+// NewMemoryIntrospectionCache creates a new in-memory cache to be used in an
+// [IntrospectionService] instance.
+// The maxAge is the maximum time for keeping entries, usually the longest of the cache TTLs.
+func NewMemoryIntrospectionCache(
+	ctx context.Context,
+	maxAge time.Duration,
+) *MemoryIntrospectionCache {
+	icache := cache.New[IntrospectionCacheKey, *IntrospectionCacheEntry](
+		cache.AutoCleanInterval(maxAge/2), //nolint:mnd
+		cache.MaxAge(maxAge),
+	)
+
+	go func() {
+		<-ctx.Done()
+		icache.StopAutoClean()
+	}()
+
+	return &MemoryIntrospectionCache{cache: icache}
+}
+
+// Get returns the cached entry for a key, or nil if there is no entry for the key.
+func (c *MemoryIntrospectionCache) Get(
+	_ context.Context,
+	key IntrospectionCacheKey,
+) (*IntrospectionCacheEntry, error) {
+	if ent, _, ks := c.cache.TryGet(key); ks == cache.Hit {
+		return ent, nil
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
+// Set stores an entry for a key until the entry expires.
+func (c *MemoryIntrospectionCache) Set(
+	_ context.Context,
+	key IntrospectionCacheKey,
+	entry *IntrospectionCacheEntry,
+) error {
+	c.cache.Set(key, entry)
+
+	return nil
+}
+
+// Get returns the cached entry for a key, or nil if there is no entry for the key.
+func (c *RedisIntrospectionCache) Get(
+	ctx context.Context,
+	key IntrospectionCacheKey,
+) (*IntrospectionCacheEntry, error) {
+	data, err := c.Client.Get(ctx, c.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil //nolint:nilnil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("redis get: %w", err)
+	}
+
+	var entry IntrospectionCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// Set stores an entry for a key until the entry expires.
+func (c *RedisIntrospectionCache) Set(
+	ctx context.Context,
+	key IntrospectionCacheKey,
+	entry *IntrospectionCacheEntry,
+) error {
+	ttl := time.Until(entry.Expires)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("JSON marshal: %w", err)
+	}
+
+	if err := c.Client.Set(ctx, c.key(key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis set: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisIntrospectionCache) key(key IntrospectionCacheKey) string {
+	return c.Prefix + hex.EncodeToString(key.Digest[:])
+}
+
+// Max returns the longest of the cache TTLs.
+func (t IntrospectionCacheTTL) Max() time.Duration {
+	return max(t.Active, t.Inactive, t.Error)
+}
+
+func (t IntrospectionCacheTTL) expires(ires *IntrospectionResponse, now time.Time) time.Time {
+	if !ires.Active {
+		return now.Add(t.Inactive)
+	}
+
+	expires := now.Add(t.Active)
+	if ires.Expiry != nil && ires.Expiry.Time().Before(expires) {
+		expires = ires.Expiry.Time()
+	}
+
+	return expires
+}
+
+func (e *IntrospectionCacheEntry) outcome() string {
+	switch {
+	case e.Response == nil:
+		return CacheOutcomeError
+	case e.Response.Active:
+		return CacheOutcomeActive
+	default:
+		return CacheOutcomeInactive
+	}
+}
+
+func (e *IntrospectionCacheEntry) result() (*IntrospectionResponse, error) {
+	if e.Response == nil {
+		return nil, fmt.Errorf("%w: %s", ErrCachedError, e.Error)
+	}
+
+	return e.Response, nil
+}
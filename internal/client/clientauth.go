@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// FormFieldClientSecret is the request form field used for providing a client secret.
+	FormFieldClientSecret = "client_secret"
+	// FormFieldClientAssertion is the request form field used for providing a client assertion.
+	FormFieldClientAssertion = "client_assertion"
+	// FormFieldClientAssertionType is the request form field used for providing the type of
+	// a client assertion.
+	FormFieldClientAssertionType = "client_assertion_type"
+)
+
+// Client authentication methods for authorization server endpoints.
+const (
+	// ClientAuthMethodNone is used by public clients, which only provide their client ID.
+	ClientAuthMethodNone = "none"
+	// ClientAuthMethodSecretBasic uses a client secret with HTTP Basic authentication.
+	ClientAuthMethodSecretBasic = "client_secret_basic"
+	// ClientAuthMethodSecretPost uses a client secret in the request form.
+	ClientAuthMethodSecretPost = "client_secret_post"
+	// ClientAuthMethodSecretJWT uses a JWT assertion (RFC 7523) signed with a client secret.
+	ClientAuthMethodSecretJWT = "client_secret_jwt"
+	// ClientAuthMethodPrivateKeyJWT uses a JWT assertion (RFC 7523) signed with a private key.
+	ClientAuthMethodPrivateKeyJWT = "private_key_jwt"
+	// ClientAuthMethodTLSClientAuth uses a PKI client certificate with mutual TLS (RFC 8705).
+	ClientAuthMethodTLSClientAuth = "tls_client_auth"
+)
+
+const (
+	// ClientAssertionTypeJWTBearer is the client assertion type for JWT assertions.
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// ClientAssertionLifetime is the lifetime of JWT client assertions.
+	ClientAssertionLifetime = 1 * time.Minute
+)
+
+// ClientAuth is implemented by client authentication methods for authorization server endpoints.
+type ClientAuth interface {
+	// Apply adds the client credentials for a request to an endpoint, either to the request form
+	// or to the request header.
+	Apply(endpoint string, form url.Values, header http.Header) error
+}
+
+// ClientNone authenticates public clients, which only provide their client ID.
+type ClientNone struct {
+	ClientID string
+}
+
+// ClientTLS authenticates clients using the client certificate presented by the [http.Client]
+// in the TLS handshake (RFC 8705), and only provides the client ID.
+type ClientTLS struct {
+	ClientID string
+}
+
+// ClientSecretBasic authenticates clients using a client secret with HTTP Basic authentication.
+type ClientSecretBasic struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// ClientSecretPost authenticates clients using a client secret in the request form.
+type ClientSecretPost struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// ClientJWT authenticates clients using JWT assertions (RFC 7523), signed either with a client
+// secret (client_secret_jwt) or with a private key (private_key_jwt). The assertions are issued
+// for the endpoint URL as their audience.
+type ClientJWT struct {
+	clientID string
+	signer   jose.Signer
+}
+
+// Apply adds the client ID to the request form.
+func (a *ClientNone) Apply(_ string, form url.Values, _ http.Header) error {
+	form.Set(FormFieldClientID, a.ClientID)
+
+	return nil
+}
+
+// Apply adds the client ID to the request form.
+func (a *ClientTLS) Apply(_ string, form url.Values, _ http.Header) error {
+	form.Set(FormFieldClientID, a.ClientID)
+
+	return nil
+}
+
+// Apply adds the client credentials to the Authorization request header.
+func (a *ClientSecretBasic) Apply(_ string, _ url.Values, header http.Header) error {
+	creds := base64.StdEncoding.EncodeToString([]byte(a.ClientID + ":" + a.ClientSecret))
+	header.Set(HeaderAuthorization, "Basic "+creds)
+
+	return nil
+}
+
+// Apply adds the client credentials to the request form.
+func (a *ClientSecretPost) Apply(_ string, form url.Values, _ http.Header) error {
+	form.Set(FormFieldClientID, a.ClientID)
+	form.Set(FormFieldClientSecret, a.ClientSecret)
+
+	return nil
+}
+
+// NewClientSecretJWT creates a new [ClientJWT] signing assertions with a client secret using
+// HMAC-SHA256. The client secret must be at least 32 bytes long.
+func NewClientSecretJWT(clientID, clientSecret string) (*ClientJWT, error) {
+	if len(clientSecret) < sha256.Size {
+		return nil, fmt.Errorf(
+			"%w: client secret shorter than %d bytes",
+			ErrUnsupportedKey,
+			sha256.Size,
+		)
+	}
+
+	key := jose.SigningKey{Algorithm: jose.HS256, Key: []byte(clientSecret)}
+
+	return newClientJWT(clientID, key, "")
+}
+
+// NewPrivateKeyJWT creates a new [ClientJWT] signing assertions with a private key.
+// The signature algorithm is chosen from the key type, and the key ID is set in the assertion
+// headers if not empty.
+func NewPrivateKeyJWT(clientID string, key crypto.Signer, keyID string) (*ClientJWT, error) {
+	alg, err := signatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClientJWT(clientID, jose.SigningKey{Algorithm: alg, Key: key}, keyID)
+}
+
+func newClientJWT(clientID string, key jose.SigningKey, keyID string) (*ClientJWT, error) {
+	opts := (&jose.SignerOptions{}).WithType("JWT") //nolint:exhaustruct
+	if keyID != "" {
+		opts = opts.WithHeader(jose.HeaderKey("kid"), keyID)
+	}
+
+	signer, err := jose.NewSigner(key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("new signer: %w", err)
+	}
+
+	a := &ClientJWT{
+		clientID: clientID,
+		signer:   signer,
+	}
+
+	return a, nil
+}
+
+// Apply adds a new client assertion for the endpoint to the request form.
+func (a *ClientJWT) Apply(endpoint string, form url.Values, _ http.Header) error {
+	now := time.Now()
+
+	claims := jwt.Claims{ //nolint:exhaustruct
+		Issuer:   a.clientID,
+		Subject:  a.clientID,
+		Audience: jwt.Audience{endpoint},
+		ID:       rand.Text(),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(ClientAssertionLifetime)),
+	}
+
+	assertion, err := jwt.Signed(a.signer).Claims(claims).Serialize()
+	if err != nil {
+		return fmt.Errorf("sign client assertion: %w", err)
+	}
+
+	form.Set(FormFieldClientID, a.clientID)
+	form.Set(FormFieldClientAssertionType, ClientAssertionTypeJWTBearer)
+	form.Set(FormFieldClientAssertion, assertion)
+
+	return nil
+}
+
+// SelectClientAuthMethod returns the first candidate client authentication method supported by
+// an endpoint. If the supported methods are unknown or none of the candidates is supported,
+// the first candidate is returned.
+func SelectClientAuthMethod(supported, candidates []string) string {
+	for _, method := range candidates {
+		if slices.Contains(supported, method) {
+			return method
+		}
+	}
+
+	return candidates[0]
+}
+
+// LoadPrivateKey reads a PEM-encoded RSA, ECDSA or Ed25519 private key from a file,
+// either in PKCS #8, PKCS #1 or SEC 1 form.
+func LoadPrivateKey(name string) (crypto.Signer, error) {
+	data, err := os.ReadFile(name) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found", ErrUnsupportedKey)
+	}
+
+	var key any
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+
+	return signer, nil
+}
+
+func signatureAlgorithm(key crypto.Signer) (jose.SignatureAlgorithm, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return jose.RS256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 256: //nolint:mnd
+			return jose.ES256, nil
+		case 384: //nolint:mnd
+			return jose.ES384, nil
+		case 521: //nolint:mnd
+			return jose.ES512, nil
+		}
+	case ed25519.PublicKey:
+		return jose.EdDSA, nil
+	}
+
+	return "", fmt.Errorf("%w: %T", ErrUnsupportedKey, key.Public())
+}
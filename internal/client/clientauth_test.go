@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func TestClientJWT(t *testing.T) {
+	t.Parallel()
+
+	const (
+		clientID = "client"
+		endpoint = "https://issuer.example.com/token"
+		secret   = "0123456789abcdef0123456789abcdef"
+	)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048) //nolint:mnd
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAuth := func(auth *ClientJWT, err error) *ClientJWT {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return auth
+	}
+
+	tests := []struct {
+		name    string
+		auth    *ClientJWT
+		key     any
+		wantAlg jose.SignatureAlgorithm
+		wantKID string
+	}{
+		{
+			"client_secret_jwt",
+			newAuth(NewClientSecretJWT(clientID, secret)),
+			[]byte(secret),
+			jose.HS256,
+			"",
+		},
+		{
+			"private_key_jwt ECDSA",
+			newAuth(NewPrivateKeyJWT(clientID, ecKey, "ec")),
+			&ecKey.PublicKey,
+			jose.ES384,
+			"ec",
+		},
+		{
+			"private_key_jwt RSA",
+			newAuth(NewPrivateKeyJWT(clientID, rsaKey, "")),
+			&rsaKey.PublicKey,
+			jose.RS256,
+			"",
+		},
+		{
+			"private_key_jwt Ed25519",
+			newAuth(NewPrivateKeyJWT(clientID, edKey, "ed")),
+			edKey.Public(),
+			jose.EdDSA,
+			"ed",
+		},
+	}
+
+	algs := append([]jose.SignatureAlgorithm{jose.HS256}, SignatureAlgorithms...)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ids := make(map[string]bool)
+
+			for range 2 {
+				form := url.Values{}
+				if err := tt.auth.Apply(endpoint, form, nil); err != nil {
+					t.Fatal(err)
+				}
+
+				if form.Get(FormFieldClientID) != clientID ||
+					form.Get(FormFieldClientAssertionType) != ClientAssertionTypeJWTBearer {
+					t.Fatalf("got form %v, want client ID and assertion type", form)
+				}
+
+				tok, err := jwt.ParseSigned(form.Get(FormFieldClientAssertion), algs)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				hdr := tok.Headers[0]
+				if hdr.Algorithm != string(tt.wantAlg) || hdr.KeyID != tt.wantKID {
+					t.Fatalf(
+						"got algorithm %q and key ID %q, want %q and %q",
+						hdr.Algorithm,
+						hdr.KeyID,
+						tt.wantAlg,
+						tt.wantKID,
+					)
+				}
+
+				var claims jwt.Claims
+				if err := tok.Claims(tt.key, &claims); err != nil {
+					t.Fatalf("verify assertion: %v", err)
+				}
+
+				err = claims.Validate(jwt.Expected{ //nolint:exhaustruct
+					Issuer:      clientID,
+					Subject:     clientID,
+					AnyAudience: jwt.Audience{endpoint},
+				})
+				if err != nil || len(claims.Audience) != 1 {
+					t.Fatalf("got claims %+v and error %v", claims, err)
+				}
+
+				lifetime := claims.Expiry.Time().Sub(claims.IssuedAt.Time())
+				if lifetime <= 0 || lifetime > ClientAssertionLifetime {
+					t.Fatalf("got lifetime %v, want up to %v", lifetime, ClientAssertionLifetime)
+				}
+
+				if claims.ID == "" || ids[claims.ID] {
+					t.Fatalf("got duplicate or empty jti %q", claims.ID)
+				}
+
+				ids[claims.ID] = true
+			}
+		})
+	}
+}
+
+func TestNewClientSecretJWTShortSecret(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewClientSecretJWT("client", strings.Repeat("s", 31))
+	if !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("got error %v, want %v", err, ErrUnsupportedKey)
+	}
+}
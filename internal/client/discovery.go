@@ -17,33 +17,63 @@ const (
 )
 
 // OIDCDiscoveryService is an OIDC discovery service for obtaining OIDC resource metadata.
+// Failed discovery requests are retried according to the retry policy, if set.
 type OIDCDiscoveryService struct {
 	Client    *http.Client
 	IssuerURL url.URL
+	Retry     *RetryPolicy
 }
 
 // OIDCDiscoveryResponse is a response from the OIDC discovery URL.
 //
 //nolint:tagliatelle
 type OIDCDiscoveryResponse struct {
+	// Issuer is the issuer identifier of the OpenID Provider.
+	Issuer string `json:"issuer"`
+	// AuthorizationEndpoint is the URL for OAuth 2.0 authorization requests.
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	// TokenEndpoint is the URL for OAuth 2.0 token requests.
+	TokenEndpoint string `json:"token_endpoint"`
+	// EndSessionEndpoint is the URL for OIDC RP-Initiated Logout requests.
+	EndSessionEndpoint string `json:"end_session_endpoint"`
 	// IntrospectionEndpoint is the URL for OAuth 2.0 Token Introspection (RFC 7662).
 	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	// JWKSURI is the URL of the JSON Web Key Set (RFC 7517) used for validating signatures.
+	JWKSURI string `json:"jwks_uri"`
+	// TokenEndpointAuthMethods are the client authentication methods supported by the token
+	// endpoint.
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+	// IntrospectionEndpointAuthMethods are the client authentication methods supported by the
+	// introspection endpoint.
+	IntrospectionEndpointAuthMethods []string `json:"introspection_endpoint_auth_methods_supported"`
+	// MTLSEndpointAliases are alternative endpoints for clients using mutual TLS (RFC 8705).
+	MTLSEndpointAliases MTLSEndpointAliases `json:"mtls_endpoint_aliases"`
+}
+
+// MTLSEndpointAliases are the alternative endpoints for clients using mutual TLS (RFC 8705).
+//
+//nolint:tagliatelle
+type MTLSEndpointAliases struct {
+	TokenEndpoint         string `json:"token_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
 }
 
 // Discover computes the OIDC discovery URL from the configured issuer URL.
 func (s *OIDCDiscoveryService) Discover(ctx context.Context) (*OIDCDiscoveryResponse, error) {
 	discoveryURL := s.IssuerURL.JoinPath(PathWellKnownOpenIDConfiguration).String()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
-	}
+	res, err := s.Retry.Do(ctx, s.Client, "discovery", func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("new request: %w", err)
+		}
 
-	req.Header.Set(HeaderAccept, ContentTypeJSON)
+		req.Header.Set(HeaderAccept, ContentTypeJSON)
 
-	res, err := s.Client.Do(req)
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("client request: %w", err)
+		return nil, err
 	}
 	defer res.Body.Close() //nolint:errcheck
 
@@ -59,18 +89,48 @@ func (s *OIDCDiscoveryService) Discover(ctx context.Context) (*OIDCDiscoveryResp
 	return &odr, nil
 }
 
-// DiscoverIntrospection discovers an introspection URL using OIDC discovery.
-func (s *OIDCDiscoveryService) DiscoverIntrospection(ctx context.Context) (*url.URL, error) {
-	odr, err := s.Discover(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("discover: %w", err)
+// UseMTLSEndpointAliases replaces the discovered endpoints with their mutual TLS aliases, if any.
+func (r *OIDCDiscoveryResponse) UseMTLSEndpointAliases() {
+	if r.MTLSEndpointAliases.TokenEndpoint != "" {
+		r.TokenEndpoint = r.MTLSEndpointAliases.TokenEndpoint
 	}
 
-	if odr.IntrospectionEndpoint == "" {
-		return nil, fmt.Errorf("%w: introspection_endpoint", ErrDiscoveryMetadataMissing)
+	if r.MTLSEndpointAliases.IntrospectionEndpoint != "" {
+		r.IntrospectionEndpoint = r.MTLSEndpointAliases.IntrospectionEndpoint
+	}
+}
+
+// AuthorizationURL returns the discovered authorization URL.
+func (r *OIDCDiscoveryResponse) AuthorizationURL() (*url.URL, error) {
+	return parseEndpoint("authorization_endpoint", r.AuthorizationEndpoint)
+}
+
+// TokenURL returns the discovered token URL.
+func (r *OIDCDiscoveryResponse) TokenURL() (*url.URL, error) {
+	return parseEndpoint("token_endpoint", r.TokenEndpoint)
+}
+
+// EndSessionURL returns the discovered end session URL.
+func (r *OIDCDiscoveryResponse) EndSessionURL() (*url.URL, error) {
+	return parseEndpoint("end_session_endpoint", r.EndSessionEndpoint)
+}
+
+// IntrospectionURL returns the discovered introspection URL.
+func (r *OIDCDiscoveryResponse) IntrospectionURL() (*url.URL, error) {
+	return parseEndpoint("introspection_endpoint", r.IntrospectionEndpoint)
+}
+
+// JWKSURL returns the discovered JSON Web Key Set URL.
+func (r *OIDCDiscoveryResponse) JWKSURL() (*url.URL, error) {
+	return parseEndpoint("jwks_uri", r.JWKSURI)
+}
+
+func parseEndpoint(name, endpoint string) (*url.URL, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("%w: %s", ErrDiscoveryMetadataMissing, name)
 	}
 
-	u, err := url.ParseRequestURI(odr.IntrospectionEndpoint)
+	u, err := url.ParseRequestURI(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("URL parser: %w", err)
 	}
@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// DPoPProofType is the JWS type of DPoP proofs.
+	DPoPProofType = "dpop+jwt"
+	// ConfirmationJKT is the confirmation method binding tokens to the JWK SHA-256 thumbprint
+	// of a DPoP key (RFC 9449).
+	ConfirmationJKT = "jkt"
+)
+
+// DPoPValidator is a validator for OAuth 2.0 Demonstrating Proof of Possession (RFC 9449) proofs.
+// Proofs must be signed using the public key in their "jwk" header, and their "htm", "htu",
+// "iat" and "ath" claims are validated. The "jti" claims of valid proofs are remembered until
+// the proofs expire in a replay cache of bounded size, so that proofs cannot be reused.
+type DPoPValidator struct {
+	maxAge  time.Duration
+	leeway  time.Duration
+	replays *replayCache
+}
+
+//nolint:tagliatelle
+type dpopProofClaims struct {
+	ID              string           `json:"jti"`
+	Method          string           `json:"htm"`
+	URI             string           `json:"htu"`
+	IssuedAt        *jwt.NumericDate `json:"iat"`
+	AccessTokenHash string           `json:"ath"`
+}
+
+// NewDPoPValidator creates a new [DPoPValidator]. The maxAge is the maximum age of proofs
+// according to their "iat" claim, the leeway is the allowed clock skew and the replaySize is
+// the maximum number of remembered proofs, which should exceed the number of proofs expected
+// within the maximum age.
+func NewDPoPValidator(maxAge, leeway time.Duration, replaySize int) *DPoPValidator {
+	v := &DPoPValidator{
+		maxAge:  maxAge,
+		leeway:  leeway,
+		replays: newReplayCache(replaySize),
+	}
+
+	return v
+}
+
+// Validate validates a DPoP proof for a request method and URI, presented together with an
+// access token, and returns the base64url-encoded JWK SHA-256 thumbprint of the proof key.
+func (v *DPoPValidator) Validate(
+	proof, method string,
+	uri *url.URL,
+	accessToken string,
+) (string, error) {
+	jws, err := jose.ParseSignedCompact(proof, SignatureAlgorithms)
+	if err != nil {
+		return "", fmt.Errorf("JWS parser: %w", err)
+	}
+
+	hdr := jws.Signatures[0].Header
+
+	if typ, _ := hdr.ExtraHeaders[jose.HeaderType].(string); typ != DPoPProofType {
+		return "", fmt.Errorf("%w: typ %q", ErrUnexpectedClaim, typ)
+	}
+
+	jwk := hdr.JSONWebKey
+	if jwk == nil || !jwk.Valid() || !jwk.IsPublic() {
+		return "", fmt.Errorf("%w: jwk", ErrMissingClaim)
+	}
+
+	payload, err := jws.Verify(jwk)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	var claims dpopProofClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	now := time.Now()
+
+	if err := v.validClaims(&claims, method, uri, accessToken, now); err != nil {
+		return "", err
+	}
+
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("JWK thumbprint: %w", err)
+	}
+
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	expires := claims.IssuedAt.Time().Add(v.maxAge + v.leeway)
+
+	added, err := v.replays.add(jkt+":"+claims.ID, expires, now)
+	if err != nil {
+		return "", err
+	}
+
+	if !added {
+		return "", fmt.Errorf("%w: jti", ErrReplayedProof)
+	}
+
+	return jkt, nil
+}
+
+func (v *DPoPValidator) validClaims(
+	claims *dpopProofClaims,
+	method string,
+	uri *url.URL,
+	accessToken string,
+	now time.Time,
+) error {
+	if claims.ID == "" {
+		return fmt.Errorf("%w: jti", ErrMissingClaim)
+	}
+
+	if claims.Method != method {
+		return fmt.Errorf("%w: htm %q", ErrUnexpectedClaim, claims.Method)
+	}
+
+	if !matchHTU(claims.URI, uri) {
+		return fmt.Errorf("%w: htu %q", ErrUnexpectedClaim, claims.URI)
+	}
+
+	if claims.IssuedAt == nil {
+		return fmt.Errorf("%w: iat", ErrMissingClaim)
+	}
+
+	iat := claims.IssuedAt.Time()
+	if iat.After(now.Add(v.leeway)) || iat.Before(now.Add(-v.maxAge-v.leeway)) {
+		return fmt.Errorf("%w: iat", ErrUnexpectedClaim)
+	}
+
+	ath := sha256.Sum256([]byte(accessToken))
+	if claims.AccessTokenHash != base64.RawURLEncoding.EncodeToString(ath[:]) {
+		return fmt.Errorf("%w: ath", ErrUnexpectedClaim)
+	}
+
+	return nil
+}
+
+// matchHTU returns whether the "htu" claim of a DPoP proof matches a request URI, ignoring
+// the query and fragment parts. The URIs are compared after case, percent-encoding and
+// scheme-based normalization (RFC 3986, sections 6.2.2 and 6.2.3).
+func matchHTU(htu string, uri *url.URL) bool {
+	u, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Scheme, uri.Scheme) &&
+		normalizeHost(u) == normalizeHost(uri) &&
+		normalizePath(u.EscapedPath()) == normalizePath(uri.EscapedPath())
+}
+
+// normalizeHost returns the lowercase host of a URI, without the default port of its scheme.
+func normalizeHost(uri *url.URL) string {
+	host := strings.ToLower(uri.Host)
+
+	switch port := uri.Port(); {
+	case port == "":
+	case port == "80" && strings.EqualFold(uri.Scheme, "http"),
+		port == "443" && strings.EqualFold(uri.Scheme, "https"):
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+
+	return host
+}
+
+// normalizePath returns an escaped URI path with percent-encoded unreserved characters decoded,
+// other percent-encodings in uppercase and an empty path replaced by "/".
+func normalizePath(escaped string) string {
+	if escaped == "" {
+		return "/"
+	}
+
+	var sb strings.Builder
+
+	for idx := 0; idx < len(escaped); idx++ {
+		if escaped[idx] != '%' || idx+2 >= len(escaped) {
+			sb.WriteByte(escaped[idx])
+
+			continue
+		}
+
+		enc := strings.ToUpper(escaped[idx+1 : idx+3])
+
+		dec, err := url.PathUnescape("%" + enc)
+		if err == nil && isUnreserved(dec[0]) {
+			sb.WriteString(dec)
+		} else {
+			sb.WriteString("%" + enc)
+		}
+
+		idx += 2
+	}
+
+	return sb.String()
+}
+
+// isUnreserved returns whether a character is unreserved in URIs (RFC 3986, section 2.3).
+func isUnreserved(char byte) bool {
+	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' ||
+		'0' <= char && char <= '9' || strings.IndexByte("-._~", char) >= 0
+}
@@ -0,0 +1,257 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// errAny matches any error in table tests.
+var errAny = errors.New("any error") //nolint:gochecknoglobals
+
+// noJWK omits the "jwk" header from DPoP proofs.
+const noJWK = "none"
+
+// dpopProof returns a DPoP proof signed with a key, embedding the public key in the "jwk" header
+// if jwk is nil, the given JWK otherwise, or no JWK if jwk is [noJWK].
+func dpopProof(t *testing.T, key *ecdsa.PrivateKey, typ string, jwk any, claims any) string {
+	t.Helper()
+
+	opts := &jose.SignerOptions{EmbedJWK: jwk == nil} //nolint:exhaustruct
+	opts = opts.WithType(jose.ContentType(typ))
+
+	if jwk != nil && jwk != noJWK {
+		opts = opts.WithHeader(jose.HeaderKey("jwk"), jwk)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return proof
+}
+
+func accessTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestDPoPValidatorValidate(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicJWK := jose.JSONWebKey{Key: &key.PublicKey} //nolint:exhaustruct
+	privateJWK := jose.JSONWebKey{Key: key}           //nolint:exhaustruct
+
+	thumbprint, err := publicJWK.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+	uri, err := url.Parse("https://api.example.com/orders/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	claims := func(jti, htm, htu string, iat time.Time, ath string) map[string]any {
+		return map[string]any{
+			"jti": jti,
+			"htm": htm,
+			"htu": htu,
+			"iat": jwt.NewNumericDate(iat),
+			"ath": ath,
+		}
+	}
+
+	ath := accessTokenHash("token")
+	htu := "https://api.example.com/orders/1"
+	validator := NewDPoPValidator(time.Minute, time.Second, 100)
+
+	tests := []struct {
+		name    string
+		proof   string
+		wantErr error
+	}{
+		{"valid", dpopProof(t, key, DPoPProofType, nil, claims("a", "GET", htu, now, ath)), nil},
+		{
+			"explicit public jwk",
+			dpopProof(t, key, DPoPProofType, publicJWK, claims("b", "GET", htu, now, ath)),
+			nil,
+		},
+		{
+			"default port",
+			dpopProof(t, key, DPoPProofType, nil, claims("c", "GET",
+				"https://API.example.com:443/orders/1?q=1", now, ath)),
+			nil,
+		},
+		{
+			"percent-encoding",
+			dpopProof(t, key, DPoPProofType, nil, claims("d", "GET",
+				"https://api.example.com/%6Frders/1", now, ath)),
+			nil,
+		},
+		{
+			"wrong typ",
+			dpopProof(t, key, "JWT", nil, claims("e", "GET", htu, now, ath)),
+			ErrUnexpectedClaim,
+		},
+		{
+			"missing jwk",
+			dpopProof(t, key, DPoPProofType, noJWK, claims("f", "GET", htu, now, ath)),
+			ErrMissingClaim,
+		},
+		{
+			"private jwk",
+			dpopProof(t, key, DPoPProofType, privateJWK, claims("g", "GET", htu, now, ath)),
+			errAny,
+		},
+		{
+			"htm mismatch",
+			dpopProof(t, key, DPoPProofType, nil, claims("h", "POST", htu, now, ath)),
+			ErrUnexpectedClaim,
+		},
+		{
+			"htu mismatch",
+			dpopProof(t, key, DPoPProofType, nil, claims("i", "GET",
+				"https://api.example.com/orders/2", now, ath)),
+			ErrUnexpectedClaim,
+		},
+		{
+			"stale iat",
+			dpopProof(t, key, DPoPProofType, nil, claims("j", "GET", htu,
+				now.Add(-2*time.Minute), ath)),
+			ErrUnexpectedClaim,
+		},
+		{
+			"future iat",
+			dpopProof(t, key, DPoPProofType, nil, claims("k", "GET", htu,
+				now.Add(time.Minute), ath)),
+			ErrUnexpectedClaim,
+		},
+		{
+			"wrong ath",
+			dpopProof(t, key, DPoPProofType, nil, claims("l", "GET", htu, now,
+				accessTokenHash("other"))),
+			ErrUnexpectedClaim,
+		},
+		{
+			"replayed jti",
+			dpopProof(t, key, DPoPProofType, nil, claims("a", "GET", htu, now, ath)),
+			ErrReplayedProof,
+		},
+	}
+
+	for _, tt := range tests { //nolint:paralleltest
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validator.Validate(tt.proof, "GET", uri, "token")
+			if tt.wantErr == errAny && err != nil { //nolint:errorlint
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && got != jkt {
+				t.Fatalf("got thumbprint %q, want %q", got, jkt)
+			}
+		})
+	}
+}
+
+func TestMatchHTU(t *testing.T) {
+	t.Parallel()
+
+	uri := &url.URL{Scheme: "https", Host: "h", Path: "/a~b"} //nolint:exhaustruct
+
+	tests := []struct {
+		htu  string
+		want bool
+	}{
+		{"https://h/a~b", true},
+		{"HTTPS://H/a~b", true},
+		{"https://h:443/a~b", true},
+		{"https://h/a%7Eb", true},
+		{"https://h/a%7eb?x=1#frag", true},
+		{"https://h:8443/a~b", false},
+		{"http://h/a~b", false},
+		{"https://h/A~b", false},
+		{"https://h/a%2Fb", false},
+		{"https://other/a~b", false},
+		{"://bad", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.htu, func(t *testing.T) {
+			t.Parallel()
+
+			if got := matchHTU(tt.htu, uri); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	root := &url.URL{Scheme: "http", Host: "h:80"} //nolint:exhaustruct
+	if !matchHTU("http://h/", root) {
+		t.Fatal("got no match for an empty path and a default port, want match")
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	t.Parallel()
+
+	cache := newReplayCache(2)
+	now := time.Now()
+
+	steps := []struct {
+		key     string
+		expires time.Time
+		now     time.Time
+		want    bool
+		wantErr error
+	}{
+		{"a", now.Add(time.Minute), now, true, nil},
+		{"a", now.Add(time.Minute), now, false, nil},
+		{"b", now.Add(2 * time.Minute), now, true, nil},
+		{"c", now.Add(time.Minute), now, false, ErrReplayCacheFull},
+		{"a", now.Add(time.Minute), now, false, nil},
+		{"c", now.Add(3 * time.Minute), now.Add(time.Minute), true, nil},
+		{"b", now.Add(2 * time.Minute), now.Add(time.Minute), false, nil},
+		{"a", now.Add(3 * time.Minute), now.Add(time.Minute), false, ErrReplayCacheFull},
+	}
+
+	for idx, step := range steps {
+		got, err := cache.add(step.key, step.expires, step.now)
+		if got != step.want || !errors.Is(err, step.wantErr) {
+			t.Fatalf("step %d: got %v and error %v, want %v and %v",
+				idx, got, err, step.want, step.wantErr)
+		}
+	}
+}
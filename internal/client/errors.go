@@ -10,6 +10,59 @@ var (
 	// ErrBadResponse is returned when a bad server response is received.
 	ErrBadResponse = errors.New("bad response")
 
+	// ErrCachedError is returned when a cached error is found for a client request.
+	ErrCachedError = errors.New("cached error")
+
+	// ErrCircuitOpen is returned when a request fails fast because its circuit breaker is open.
+	ErrCircuitOpen = errors.New("circuit open")
+
 	// ErrDiscoveryMetadataMissing is returned when OIDC discovery metadata is missing.
 	ErrDiscoveryMetadataMissing = errors.New("discovery metadata missing")
+
+	// ErrInvalidLogoutToken is returned when a logout token is not valid.
+	ErrInvalidLogoutToken = errors.New("invalid logout token")
+
+	// ErrInvalidSignature is returned when a token signature cannot be verified.
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrMissingClaim is returned when a required token claim is missing.
+	ErrMissingClaim = errors.New("missing claim")
+
+	// ErrNoCertificates is returned when no certificates are found in a certificate file.
+	ErrNoCertificates = errors.New("no certificates")
+
+	// ErrPinMismatch is returned when no server certificate matches the pinned public keys.
+	ErrPinMismatch = errors.New("pin mismatch")
+
+	// ErrReplayCacheFull is returned when a replay cache cannot remember more keys until some of
+	// its keys expire.
+	ErrReplayCacheFull = errors.New("replay cache full")
+
+	// ErrReplayedProof is returned when a proof of possession is used more than once.
+	ErrReplayedProof = errors.New("replayed proof")
+
+	// ErrReplayedToken is returned when a single-use token is used more than once.
+	ErrReplayedToken = errors.New("replayed token")
+
+	// ErrUnexpectedClaim is returned when a token has a claim that is not allowed.
+	ErrUnexpectedClaim = errors.New("unexpected claim")
+
+	// ErrUnknownKey is returned when a key ID is not found in a JSON Web Key Set.
+	ErrUnknownKey = errors.New("unknown key")
+
+	// ErrUnknownIssuer is returned when an issuer name is not found.
+	ErrUnknownIssuer = errors.New("unknown issuer")
+
+	// ErrUntrustedIssuer is returned when a token is not routed to any known issuer.
+	ErrUntrustedIssuer = errors.New("untrusted issuer")
+
+	// ErrUnsupportedClientAuthMethod is returned when an unsupported client authentication method
+	// is used.
+	ErrUnsupportedClientAuthMethod = errors.New("unsupported client authentication method")
+
+	// ErrUnsupportedKey is returned when a key of an unsupported type is used.
+	ErrUnsupportedKey = errors.New("unsupported key")
+
+	// ErrUnsupportedTokenType is returned when a token of an unsupported type is issued.
+	ErrUnsupportedTokenType = errors.New("unsupported token type")
 )
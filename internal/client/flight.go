@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// flightGroup coalesces concurrent calls with the same key, so that only one call per key is in
+// flight at a time and all callers receive its result. The zero value is ready to use.
+type flightGroup[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*flightCall[V]
+}
+
+type flightCall[V any] struct {
+	done    chan struct{}
+	ctx     *flightContext
+	waiters int
+	val     V
+	err     error
+}
+
+// Do calls fn for a key, unless a call for the same key is already in flight, in which case
+// it waits for the result of that call instead.
+//
+// The call runs with a context that is detached from the cancellation of any individual
+// caller, so that callers giving up do not fail the call for the remaining callers, and that
+// has the longest deadline of its callers, if all of them have one.
+// If a caller context is done before the call completes, Do returns early with the context
+// error, and the call context is canceled once all of its callers have given up.
+func (g *flightGroup[K, V]) Do(
+	ctx context.Context,
+	key K,
+	fn func(ctx context.Context) (V, error),
+) (V, error) {
+	g.mu.Lock()
+
+	if g.calls == nil {
+		g.calls = make(map[K]*flightCall[V])
+	}
+
+	call, ok := g.calls[key]
+	if ok {
+		call.ctx.extend(ctx)
+	} else {
+		call = &flightCall[V]{ //nolint:exhaustruct
+			done: make(chan struct{}),
+			ctx:  detach(ctx),
+		}
+		g.calls[key] = call
+
+		go g.run(call.ctx, key, call, fn)
+	}
+
+	call.waiters++
+
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		g.leave(key, call)
+
+		var zero V
+
+		return zero, fmt.Errorf("wait: %w", context.Cause(ctx))
+	}
+}
+
+func (g *flightGroup[K, V]) run(
+	ctx context.Context,
+	key K,
+	call *flightCall[V],
+	fn func(ctx context.Context) (V, error),
+) {
+	defer call.ctx.cancel()
+
+	call.val, call.err = fn(ctx)
+
+	g.mu.Lock()
+	g.forget(key, call)
+	g.mu.Unlock()
+
+	close(call.done)
+}
+
+func (g *flightGroup[K, V]) leave(key K, call *flightCall[V]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	call.waiters--
+	if call.waiters == 0 {
+		call.ctx.cancel()
+		g.forget(key, call)
+	}
+}
+
+func (g *flightGroup[K, V]) forget(key K, call *flightCall[V]) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// flightContext is a context that is detached from the cancellation of a parent context, but
+// that keeps its values, with a deadline that can be extended by further callers.
+type flightContext struct {
+	context.Context //nolint:containedctx
+
+	cancelCause context.CancelCauseFunc
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// detach returns a flight context for a parent context, with the parent deadline, if any.
+func detach(ctx context.Context) *flightContext {
+	cctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	fctx := &flightContext{Context: cctx, cancelCause: cancel} //nolint:exhaustruct
+
+	if deadline, ok := ctx.Deadline(); ok {
+		fctx.deadline = deadline
+		fctx.timer = time.AfterFunc(time.Until(deadline), func() {
+			cancel(context.DeadlineExceeded)
+		})
+	}
+
+	return fctx
+}
+
+// Deadline returns the current deadline of the context, if any.
+func (c *flightContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.deadline, !c.deadline.IsZero()
+}
+
+// Err returns [context.DeadlineExceeded] if the deadline of the context passed, or
+// [context.Canceled] if the context was canceled.
+func (c *flightContext) Err() error {
+	if c.Context.Err() == nil {
+		return nil
+	}
+
+	if cause := context.Cause(c.Context); errors.Is(cause, context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+
+	return context.Canceled
+}
+
+// extend extends the deadline of the context to the deadline of a further caller context,
+// if later, or removes it if the caller context has no deadline.
+func (c *flightContext) extend(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer == nil {
+		return
+	}
+
+	deadline, ok := ctx.Deadline()
+
+	switch {
+	case !ok:
+		c.timer.Stop()
+		c.timer = nil
+		c.deadline = time.Time{}
+	case deadline.After(c.deadline):
+		c.timer.Reset(time.Until(deadline))
+		c.deadline = deadline
+	}
+}
+
+// cancel cancels the context and stops its deadline timer, if any.
+func (c *flightContext) cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	c.cancelCause(nil)
+}
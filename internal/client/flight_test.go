@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCallerDeadline(t *testing.T) {
+	t.Parallel()
+
+	var group flightGroup[string, string]
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	fn := func(ctx context.Context) (string, error) {
+		close(started)
+
+		select {
+		case <-release:
+			return "ok", ctx.Err()
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	first, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+
+	firstErr := make(chan error, 1)
+
+	go func() {
+		_, err := group.Do(first, "key", fn)
+		firstErr <- err
+	}()
+
+	<-started
+
+	second := make(chan string, 1)
+
+	go func() {
+		val, err := group.Do(t.Context(), "key", fn)
+		if err != nil {
+			t.Errorf("unexpected error for the second caller: %v", err)
+		}
+
+		second <- val
+	}()
+
+	for group.waiters("key") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := <-firstErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v for the first caller, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Give a call inheriting the deadline of the first caller the time to fail.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if val := <-second; val != "ok" {
+		t.Fatalf("got value %q for the second caller, want %q", val, "ok")
+	}
+}
+
+func TestFlightGroupLongestDeadline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		second     time.Duration
+		wantSecond bool
+	}{
+		{"later deadline", 2 * time.Minute, true},
+		{"earlier deadline", 30 * time.Second, false},
+		{"no deadline", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var group flightGroup[string, time.Time]
+
+			started := make(chan struct{})
+			joined := make(chan struct{})
+
+			fn := func(ctx context.Context) (time.Time, error) {
+				close(started)
+				<-joined
+
+				deadline, _ := ctx.Deadline()
+
+				return deadline, nil
+			}
+
+			first, cancel := context.WithTimeout(t.Context(), time.Minute)
+			defer cancel()
+
+			second := t.Context()
+			if tt.second > 0 {
+				var cancel context.CancelFunc
+
+				second, cancel = context.WithTimeout(second, tt.second)
+				defer cancel()
+			}
+
+			want, _ := first.Deadline()
+			if tt.wantSecond {
+				want, _ = second.Deadline()
+			}
+
+			got := make(chan time.Time, 1)
+
+			go func() {
+				deadline, _ := group.Do(first, "key", fn)
+				got <- deadline
+			}()
+
+			<-started
+
+			go func() {
+				_, _ = group.Do(second, "key", fn)
+			}()
+
+			for group.waiters("key") < 2 {
+				time.Sleep(time.Millisecond)
+			}
+
+			close(joined)
+
+			if deadline := <-got; !deadline.Equal(want) {
+				t.Fatalf("got call deadline %v, want %v", deadline, want)
+			}
+		})
+	}
+}
+
+func (g *flightGroup[K, V]) waiters(key K) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if call, ok := g.calls[key]; ok {
+		return call.waiters
+	}
+
+	return 0
+}
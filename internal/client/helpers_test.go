@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const testIssuer = "https://issuer.example.com"
+
+// testKeys is a signing key served in a JSON Web Key Set by a test server.
+type testKeys struct {
+	key  *ecdsa.PrivateKey
+	jwks *JWKSService
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{ //nolint:exhaustruct
+		{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.ES256), Use: KeyUseSignature},
+	}}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(srv.Close)
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := &testKeys{
+		key: key,
+		jwks: &JWKSService{ //nolint:exhaustruct
+			Client:          srv.Client(),
+			URL:             *srvURL,
+			RefreshInterval: time.Minute,
+		},
+	}
+
+	return keys
+}
+
+// sign returns a signed JWT with the given claims and JOSE type header, if not empty.
+func (k *testKeys) sign(t *testing.T, typ string, claims any) string {
+	t.Helper()
+
+	return k.signWithKeyID(t, "test", typ, claims)
+}
+
+// signWithKeyID returns a signed JWT like [testKeys.sign], using the given key ID header.
+func (k *testKeys) signWithKeyID(t *testing.T, kid, typ string, claims any) string {
+	t.Helper()
+
+	opts := (&jose.SignerOptions{}).WithHeader(jose.HeaderKey("kid"), kid) //nolint:exhaustruct
+	if typ != "" {
+		opts = opts.WithType(jose.ContentType(typ))
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: k.key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
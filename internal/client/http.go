@@ -4,14 +4,23 @@
 package client
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"time"
 )
 
 // HTTP headers used by the client package.
 const (
-	HeaderAccept      = "Accept"
-	HeaderContentType = "Content-Type"
+	HeaderAccept        = "Accept"
+	HeaderAuthorization = "Authorization"
+	HeaderContentType   = "Content-Type"
 )
 
 // Content types used by the client package.
@@ -25,11 +34,56 @@ const (
 	ResponseHeaderTimeout = 60 * time.Second
 )
 
+// ClientConfig is the configuration for HTTP clients.
+type ClientConfig struct {
+	// Certificates are the certificates presented for TLS client authentication, if any.
+	Certificates []tls.Certificate
+	// RootCAs are the certificate authorities for verifying server certificates
+	// (defaults to the system certificate pool).
+	RootCAs *x509.CertPool
+	// MinVersion is the minimum TLS version (defaults to TLS 1.2).
+	MinVersion uint16
+	// Pins are the base64-encoded SHA-256 hashes of the subject public key info (SPKI) of
+	// server certificates. If any, one of the certificates in the verified chain must match a pin.
+	Pins []string
+	// Proxy is the URL of the HTTP(S) proxy (defaults to the proxy from the environment).
+	Proxy *url.URL
+	// MaxIdleConns is the maximum number of idle connections (defaults to 100).
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the maximum number of idle connections per host (defaults to 2).
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost is the maximum number of connections per host (defaults to no limit).
+	MaxConnsPerHost int
+}
+
 // NewClient creates a new [http.Client] that uses a clone of [http.DefaultTransport]
-// configured with a response header timeout.
-func NewClient() *http.Client {
+// configured with a response header timeout and the given configuration.
+func NewClient(cfg *ClientConfig) *http.Client {
 	t := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
 	t.ResponseHeaderTimeout = ResponseHeaderTimeout
+	t.TLSClientConfig = &tls.Config{ //nolint:exhaustruct
+		Certificates: cfg.Certificates,
+		RootCAs:      cfg.RootCAs,
+		MinVersion:   max(cfg.MinVersion, tls.VersionTLS12),
+	}
+
+	if len(cfg.Pins) > 0 {
+		t.TLSClientConfig.VerifyConnection = verifyPins(cfg.Pins)
+	}
+
+	if cfg.Proxy != nil {
+		t.Proxy = http.ProxyURL(cfg.Proxy)
+	}
+
+	if cfg.MaxIdleConns > 0 {
+		t.MaxIdleConns = cfg.MaxIdleConns
+	}
+
+	if cfg.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+
+	t.MaxConnsPerHost = cfg.MaxConnsPerHost
 
 	c := &http.Client{ //nolint:exhaustruct
 		Transport: t,
@@ -37,3 +91,39 @@ func NewClient() *http.Client {
 
 	return c
 }
+
+// LoadCertPool reads a pool of PEM-encoded certificate authorities from a file.
+func LoadCertPool(name string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(name) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrNoCertificates
+	}
+
+	return pool, nil
+}
+
+// verifyPins returns a TLS connection verifier requiring a certificate in the verified chains
+// with a subject public key info (SPKI) hash matching one of the pins.
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				hash := []byte(base64.StdEncoding.EncodeToString(sum[:]))
+
+				for _, pin := range pins {
+					if subtle.ConstantTimeCompare(hash, []byte(pin)) == 1 {
+						return nil
+					}
+				}
+			}
+		}
+
+		return ErrPinMismatch
+	}
+}
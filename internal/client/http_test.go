@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its private key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by a parent certificate, or self-signed if nil.
+func newTestCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{ //nolint:exhaustruct
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name}, //nolint:exhaustruct
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)}, //nolint:mnd
+	}
+
+	signer := &testCert{cert: tmpl, key: key}
+	if parent != nil {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key}
+}
+
+// pin returns the SPKI pin of the certificate.
+func (c *testCert) pin() string {
+	sum := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyPins(t *testing.T) {
+	t.Parallel()
+
+	root := newTestCert(t, "root", true, nil)
+	intermediate := newTestCert(t, "intermediate", true, root)
+	leaf := newTestCert(t, "leaf", false, intermediate)
+	other := newTestCert(t, "other", true, nil)
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.TLS = &tls.Config{ //nolint:exhaustruct
+		Certificates: []tls.Certificate{{ //nolint:exhaustruct
+			Certificate: [][]byte{leaf.cert.Raw, intermediate.cert.Raw},
+			PrivateKey:  leaf.key,
+		}},
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(root.cert)
+
+	tests := []struct {
+		name    string
+		pins    []string
+		wantErr error
+	}{
+		{"no pins", nil, nil},
+		{"leaf pin", []string{leaf.pin()}, nil},
+		{"intermediate pin", []string{intermediate.pin()}, nil},
+		{"root pin", []string{root.pin()}, nil},
+		{"any of the pins", []string{other.pin(), intermediate.pin()}, nil},
+		{"mismatching pin", []string{other.pin()}, ErrPinMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clnt := NewClient(&ClientConfig{RootCAs: pool, Pins: tt.pins}) //nolint:exhaustruct
+
+			res, err := clnt.Get(srv.URL) //nolint:noctx
+			if err == nil {
+				_ = res.Body.Close()
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
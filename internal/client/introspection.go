@@ -4,15 +4,20 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/twmb/go-cache/cache"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/metrics"
 )
 
 const (
@@ -22,86 +27,314 @@ const (
 	FormFieldTokenTypeHint = "token_type_hint"
 )
 
+const (
+	// ClaimConfirmation is the claim with the confirmation methods of sender-constrained tokens
+	// (RFC 7800).
+	ClaimConfirmation = "cnf"
+	// ConfirmationX5TS256 is the confirmation method binding tokens to the SHA-256 thumbprint of
+	// a client certificate (RFC 8705).
+	ConfirmationX5TS256 = "x5t#S256"
+)
+
+// Introspector is implemented by token validators that report token metadata
+// in the form of an OAuth 2.0 Token Introspection (RFC 7662) response.
+type Introspector interface {
+	Introspect(ctx context.Context, token, tokenTypeHint string) (*IntrospectionResponse, error)
+}
+
 // IntrospectionService is an OAuth 2.0 Token Introspection (RFC 7662) service for token validation.
+// Concurrent introspections of the same token are coalesced into a single introspection request.
+// Tokens are only kept in memory for the duration of introspection requests, while cached
+// introspection outcomes are keyed using token hashes.
+// If a revocation store is set, cached active responses are discarded when their subject or
+// session ("sid" claim) was revoked after they were cached.
+// Failed introspection requests are retried according to the retry policy, if set, and fail
+// fast while the circuit breaker, if set, is open.
 type IntrospectionService struct {
-	Client       *http.Client
-	URL          url.URL
-	ClientID     string
-	ClientSecret string
-	Cache        *cache.Cache[IntrospectionCacheKey, *IntrospectionResponse]
-}
+	Client      *http.Client
+	URL         url.URL
+	Auth        ClientAuth
+	Cache       IntrospectionCache
+	CacheTTL    IntrospectionCacheTTL
+	Hasher      *TokenHasher
+	Revocations RevocationStore
+	Retry       *RetryPolicy
+	Breaker     *CircuitBreaker
 
-// IntrospectionCacheKey is the key used for caching introspection requests.
-type IntrospectionCacheKey struct {
-	Token         string
-	TokenTypeHint string
+	flight flightGroup[IntrospectionCacheKey, *IntrospectionResponse]
 }
 
 // IntrospectionResponse is a response from the token introspection URL.
 //
 //nolint:tagliatelle
 type IntrospectionResponse struct {
-	Active   bool   `json:"active"`
-	ClientID string `json:"client_id"`
-	Scope    string `json:"scope"`
-	Subject  string `json:"sub"`
+	Active   bool     `json:"active"`
+	ClientID string   `json:"client_id,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	Subject  string   `json:"sub,omitempty"`
+	Audience Audience `json:"aud,omitempty"`
+
+	// Expiry is the expiration time of the token, if provided.
+	Expiry *jwt.NumericDate `json:"exp,omitempty"`
+
+	// Claims is the full set of claims in the response, including extension members.
+	// JSON numbers are decoded as [json.Number] values.
+	Claims map[string]any `json:"-"`
 }
 
-// NewIntrospectionCache creates a new cache to be used in an [IntrospectionService] instance.
-func NewIntrospectionCache(
-	ctx context.Context,
-	expireAfter time.Duration,
-) *cache.Cache[IntrospectionCacheKey, *IntrospectionResponse] {
-	icache := cache.New[IntrospectionCacheKey, *IntrospectionResponse](
-		cache.AutoCleanInterval(expireAfter/2), //nolint:mnd
-		cache.MaxAge(expireAfter),
-	)
+// UnmarshalJSON decodes an introspection response, keeping the full set of claims.
+func (r *IntrospectionResponse) UnmarshalJSON(data []byte) error {
+	type response IntrospectionResponse
+
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	claims, err := decodeClaims(data)
+	if err != nil {
+		return fmt.Errorf("decode claims: %w", err)
+	}
+
+	*r = IntrospectionResponse(res)
+	r.Claims = claims
+
+	return nil
+}
+
+// MarshalJSON encodes an introspection response, including the full set of claims.
+func (r *IntrospectionResponse) MarshalJSON() ([]byte, error) {
+	type response IntrospectionResponse
+
+	data, err := json.Marshal((*response)(r))
+	if err != nil || len(r.Claims) == 0 {
+		return data, err //nolint:wrapcheck
+	}
+
+	fields, err := decodeClaims(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+
+	claims := maps.Clone(r.Claims)
+	maps.Copy(claims, fields)
 
-	go func() {
-		<-ctx.Done()
-		icache.StopAutoClean()
-	}()
+	return json.Marshal(claims) //nolint:wrapcheck
+}
+
+// Expired returns whether the token has an expiration time that is not after a given time.
+func (r *IntrospectionResponse) Expired(now time.Time) bool {
+	return r.Expiry != nil && !now.Before(r.Expiry.Time())
+}
+
+// Claim returns the value of a claim in the response.
+// Members of nested JSON objects can be selected using a dot-separated path, e.g. "realm.roles".
+func (r *IntrospectionResponse) Claim(path string) (any, bool) {
+	var val any = r.Claims
+
+	for name := range strings.SplitSeq(path, ".") {
+		obj, ok := val.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		if val, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
 
-	return icache
+	return val, true
+}
+
+// Confirmation returns the value of a confirmation method in the "cnf" claim of the response,
+// or an empty string if the token is not bound using the confirmation method.
+func (r *IntrospectionResponse) Confirmation(method string) string {
+	cnf, ok := r.Claims[ClaimConfirmation].(map[string]any)
+	if !ok {
+		return ""
+	}
+
+	val, _ := cnf[method].(string)
+
+	return val
+}
+
+// Audience is the audience of a token, which can be a single string or an array of strings
+// as defined in JSON Web Token (RFC 7519).
+type Audience []string
+
+// UnmarshalJSON decodes an audience from either a JSON string or a JSON array of strings.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var auds []string
+	if err := json.Unmarshal(data, &auds); err == nil {
+		*a = auds
+
+		return nil
+	}
+
+	var aud string
+	if err := json.Unmarshal(data, &aud); err != nil {
+		return fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	*a = Audience{aud}
+
+	return nil
+}
+
+// Contains returns whether the audience contains a given value.
+func (a Audience) Contains(val string) bool {
+	return slices.Contains(a, val)
 }
 
 // Introspect performs token validation using token introspection.
+// Introspection outcomes are cached according to the configured cache TTLs.
 func (s *IntrospectionService) Introspect(
 	ctx context.Context,
 	token, tokenTypeHint string,
 ) (*IntrospectionResponse, error) {
-	cacheKey := IntrospectionCacheKey{
-		Token:         token,
-		TokenTypeHint: tokenTypeHint,
+	cacheKey := s.Hasher.CacheKey(token, tokenTypeHint)
+
+	now := time.Now()
+
+	if ent := s.cacheGet(ctx, cacheKey); ent != nil && now.Before(ent.Expires) &&
+		!s.revoked(ctx, ent) {
+		metrics.IntrospectionCacheHitsTotal.WithLabelValues(ent.outcome()).Inc()
+
+		return ent.result()
+	}
+
+	metrics.IntrospectionCacheMissesTotal.Inc()
+
+	return s.flight.Do(ctx, cacheKey, func(ctx context.Context) (*IntrospectionResponse, error) {
+		return s.introspectAndCache(ctx, cacheKey, token, tokenTypeHint)
+	})
+}
+
+func (s *IntrospectionService) introspectAndCache(
+	ctx context.Context,
+	cacheKey IntrospectionCacheKey,
+	token, tokenTypeHint string,
+) (*IntrospectionResponse, error) {
+	if err := s.Breaker.Allow(); err != nil {
+		return nil, err
 	}
 
-	if ir, _, ks := s.Cache.TryGet(cacheKey); ks == cache.Hit {
-		return ir, nil
+	ires, err := s.introspect(ctx, token, tokenTypeHint)
+	now := time.Now()
+
+	s.Breaker.Done(err)
+
+	if err != nil {
+		if ctx.Err() == nil && s.CacheTTL.Error > 0 {
+			s.cacheSet(ctx, cacheKey, &IntrospectionCacheEntry{ //nolint:exhaustruct
+				Error:   err.Error(),
+				Created: now,
+				Expires: now.Add(s.CacheTTL.Error),
+			})
+		}
+
+		return nil, err
 	}
 
-	introspectionURL := s.URL.String()
+	if ires.Expired(now) {
+		ires = &IntrospectionResponse{Active: false} //nolint:exhaustruct
+	}
+
+	if expires := s.CacheTTL.expires(ires, now); expires.After(now) {
+		s.cacheSet(ctx, cacheKey, &IntrospectionCacheEntry{ //nolint:exhaustruct
+			Response: ires,
+			Created:  now,
+			Expires:  expires,
+		})
+	}
+
+	return ires, nil
+}
 
-	form := &url.Values{}
-	form.Set(FormFieldToken, cacheKey.Token)
+// cacheGet returns a cached entry, treating cache errors as cache misses.
+func (s *IntrospectionService) cacheGet(
+	ctx context.Context,
+	cacheKey IntrospectionCacheKey,
+) *IntrospectionCacheEntry {
+	ent, err := s.Cache.Get(ctx, cacheKey)
+	if err != nil {
+		slog.Warn("introspection cache get failed", "err", err)
+
+		return nil
+	}
+
+	return ent
+}
 
-	if cacheKey.TokenTypeHint != "" {
-		form.Set(FormFieldTokenTypeHint, cacheKey.TokenTypeHint)
+// revoked returns whether a cached active response was revoked after it was cached,
+// treating revocation store errors as revocations.
+func (s *IntrospectionService) revoked(ctx context.Context, ent *IntrospectionCacheEntry) bool {
+	if s.Revocations == nil || ent.Response == nil || !ent.Response.Active {
+		return false
 	}
 
-	body := strings.NewReader(form.Encode())
+	sid, _ := ent.Response.Claim(ClaimSessionID)
+	sidStr, _ := sid.(string)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, introspectionURL, body)
+	revokedAt, err := s.Revocations.RevokedAt(
+		ctx,
+		RevocationKeys(ent.Response.Subject, sidStr)...,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("new request: %w", err)
+		slog.Warn("revocation store get failed", "err", err)
+
+		return true
+	}
+
+	return !revokedAt.IsZero() && !revokedAt.Before(ent.Created)
+}
+
+// cacheSet stores an entry in the cache, ignoring cache errors.
+func (s *IntrospectionService) cacheSet(
+	ctx context.Context,
+	cacheKey IntrospectionCacheKey,
+	ent *IntrospectionCacheEntry,
+) {
+	if err := s.Cache.Set(ctx, cacheKey, ent); err != nil {
+		slog.Warn("introspection cache set failed", "err", err)
 	}
+}
+
+func (s *IntrospectionService) introspect(
+	ctx context.Context,
+	token, tokenTypeHint string,
+) (*IntrospectionResponse, error) {
+	introspectionURL := s.URL.String()
 
-	req.Header.Set(HeaderAccept, ContentTypeJSON)
-	req.Header.Set(HeaderContentType, ContentTypeFormURLEncoded)
-	req.SetBasicAuth(s.ClientID, s.ClientSecret)
+	res, err := s.Retry.Do(ctx, s.Client, "introspection", func() (*http.Request, error) {
+		form := url.Values{}
+		form.Set(FormFieldToken, token)
 
-	res, err := s.Client.Do(req)
+		if tokenTypeHint != "" {
+			form.Set(FormFieldTokenTypeHint, tokenTypeHint)
+		}
+
+		header := http.Header{}
+		if err := s.Auth.Apply(introspectionURL, form, header); err != nil {
+			return nil, fmt.Errorf("client auth: %w", err)
+		}
+
+		body := strings.NewReader(form.Encode())
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, introspectionURL, body)
+		if err != nil {
+			return nil, fmt.Errorf("new request: %w", err)
+		}
+
+		maps.Copy(req.Header, header)
+		req.Header.Set(HeaderAccept, ContentTypeJSON)
+		req.Header.Set(HeaderContentType, ContentTypeFormURLEncoded)
+
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("client request: %w", err)
+		return nil, err
 	}
 	defer res.Body.Close() //nolint:errcheck
 
@@ -114,7 +347,17 @@ func (s *IntrospectionService) Introspect(
 		return nil, fmt.Errorf("JSON decoder: %w", err)
 	}
 
-	s.Cache.Set(cacheKey, &ires)
-
 	return &ires, nil
 }
+
+func decodeClaims(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var claims map[string]any
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("JSON decoder: %w", err)
+	}
+
+	return claims, nil
+}
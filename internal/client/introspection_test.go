@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospectionServiceRevokedCache(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		_, _ = w.Write([]byte(`{"active":true,"sub":"alice"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher, err := NewTokenHasher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ttl := IntrospectionCacheTTL{Active: time.Hour, Inactive: time.Hour, Error: 0}
+	revs := NewMemoryRevocationStore(t.Context(), time.Hour)
+
+	isrv := &IntrospectionService{ //nolint:exhaustruct
+		Client:      srv.Client(),
+		URL:         *srvURL,
+		Auth:        &ClientSecretBasic{ClientID: "client", ClientSecret: "secret"},
+		Cache:       NewMemoryIntrospectionCache(t.Context(), ttl.Max()),
+		CacheTTL:    ttl,
+		Hasher:      hasher,
+		Revocations: revs,
+	}
+
+	introspect := func(token string, wantRequests int32) {
+		t.Helper()
+
+		ires, err := isrv.Introspect(t.Context(), token, "")
+		if err != nil {
+			t.Fatalf("introspect %q: %v", token, err)
+		}
+
+		if !ires.Active {
+			t.Fatalf("introspect %q: inactive response", token)
+		}
+
+		if got := requests.Load(); got != wantRequests {
+			t.Fatalf(
+				"introspect %q: got %d introspection requests, want %d",
+				token,
+				got,
+				wantRequests,
+			)
+		}
+	}
+
+	introspect("old", 1)
+	introspect("old", 1)
+
+	if err := revs.Revoke(t.Context(), RevocationKeyPrefixSubject+"alice", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	introspect("old", 2)
+	introspect("new", 3)
+	introspect("new", 3)
+}
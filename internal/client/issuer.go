@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// Issuer is a token issuer, e.g. a tenant of an identity provider, with its own [Introspector].
+type Issuer struct {
+	// Name is the name used for selecting the issuer explicitly.
+	Name string
+	// Identifier is the issuer identifier matched against the "iss" claim of JWT tokens, if any.
+	Identifier string
+	// Hosts are the request hosts served by the issuer. A leading "*." matches any subdomain.
+	Hosts []string
+	// Introspector is used for validating the tokens of the issuer.
+	Introspector Introspector
+}
+
+// IssuerRouter routes tokens to the [Introspector] of their issuer, allowing multiple issuers
+// to be served from a single auth endpoint.
+type IssuerRouter struct {
+	// Issuers are the known issuers.
+	Issuers []*Issuer
+	// Default is used for tokens that are not routed to any known issuer, if set.
+	Default Introspector
+}
+
+// Route returns the introspector for a token. The issuer is selected by name if given,
+// otherwise by the first issuer serving a request host, or by the issuer identifier in the
+// (unverified) "iss" claim of JWT tokens. The selected issuer validates the token as usual.
+// If no issuer is selected, the default introspector is returned if set.
+func (r *IssuerRouter) Route(name, host, token string) (Introspector, error) {
+	if name != "" {
+		for _, iss := range r.Issuers {
+			if iss.Name == name {
+				return iss.Introspector, nil
+			}
+		}
+
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIssuer, name)
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, iss := range r.Issuers {
+		if slices.ContainsFunc(iss.Hosts, func(val string) bool { return matchHost(val, host) }) {
+			return iss.Introspector, nil
+		}
+	}
+
+	if claim := unverifiedIssuer(token); claim != "" {
+		for _, iss := range r.Issuers {
+			if iss.Identifier != "" && iss.Identifier == claim {
+				return iss.Introspector, nil
+			}
+		}
+	}
+
+	if r.Default == nil {
+		return nil, ErrUntrustedIssuer
+	}
+
+	return r.Default, nil
+}
+
+// unverifiedIssuer returns the "iss" claim of a JWT token without verifying its signature,
+// or an empty string if the token is not a JWT.
+func unverifiedIssuer(token string) string {
+	tok, err := jwt.ParseSigned(token, SignatureAlgorithms)
+	if err != nil {
+		return ""
+	}
+
+	var claims jwt.Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return ""
+	}
+
+	return claims.Issuer
+}
+
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:]))
+	}
+
+	return strings.EqualFold(pattern, host)
+}
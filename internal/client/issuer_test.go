@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func TestIssuerRouterRoute(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+
+	tenantA := &countingIntrospector{}  //nolint:exhaustruct
+	tenantB := &countingIntrospector{}  //nolint:exhaustruct
+	fallback := &countingIntrospector{} //nolint:exhaustruct
+
+	issuers := []*Issuer{
+		{
+			Name:         "tenant-a",
+			Identifier:   "https://a.example.com",
+			Hosts:        []string{"api.a.example.com"},
+			Introspector: tenantA,
+		},
+		{
+			Name:         "tenant-b",
+			Identifier:   "https://b.example.com",
+			Hosts:        []string{"*.b.example.com"},
+			Introspector: tenantB,
+		},
+	}
+
+	router := &IssuerRouter{Issuers: issuers, Default: nil}
+	drouter := &IssuerRouter{Issuers: issuers, Default: fallback}
+
+	token := func(iss string) string {
+		return keys.sign(t, JWTAccessTokenType, map[string]any{
+			"iss": iss,
+			"exp": jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		})
+	}
+
+	tokenB := token("https://b.example.com")
+	tokenC := token("https://c.example.com")
+
+	tests := []struct {
+		name    string
+		router  *IssuerRouter
+		issuer  string
+		host    string
+		token   string
+		want    Introspector
+		wantErr error
+	}{
+		{"by name", router, "tenant-b", "api.a.example.com", "opaque", tenantB, nil},
+		{"unknown name", drouter, "tenant-c", "", "opaque", nil, ErrUnknownIssuer},
+		{"exact host", router, "", "api.a.example.com", "opaque", tenantA, nil},
+		{"host with port", router, "", "API.a.example.com:443", "opaque", tenantA, nil},
+		{"wildcard host", router, "", "api.b.example.com", "opaque", tenantB, nil},
+		{"nested wildcard host", router, "", "x.api.b.example.com", "opaque", tenantB, nil},
+		{"wildcard parent host", router, "", "b.example.com", "opaque", nil, ErrUntrustedIssuer},
+		{"host before token", router, "", "api.a.example.com", tokenB, tenantA, nil},
+		{"token issuer", router, "", "other.example.com", tokenB, tenantB, nil},
+		{"unknown token issuer", drouter, "", "", tokenC, fallback, nil},
+		{"default", drouter, "", "other.example.com", "opaque", fallback, nil},
+		{"no default", router, "", "other.example.com", "opaque", nil, ErrUntrustedIssuer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.router.Route(tt.issuer, tt.host, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("got introspector %p, want %p", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"api.example.com", "api.example.com", true},
+		{"api.example.com", "API.Example.com", true},
+		{"api.example.com", "www.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.Example.com", "API.example.COM", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.host, func(t *testing.T) {
+			t.Parallel()
+
+			if got := matchHost(tt.pattern, tt.host); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
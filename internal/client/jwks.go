@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	// KeyUseSignature is the public key use value for signature keys.
+	KeyUseSignature = "sig"
+)
+
+// JWKSService is a JSON Web Key Set (RFC 7517) service for obtaining token signing keys.
+// Key sets are cached and refetched when an unknown key ID is requested, but not more often
+// than the configured refresh interval, including after failed fetches. Concurrent refetches
+// are coalesced into a single request.
+type JWKSService struct {
+	Client          *http.Client
+	URL             url.URL
+	RefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      jose.JSONWebKeySet
+	fetchedAt time.Time
+	fetchErr  error
+	flight    flightGroup[struct{}, struct{}]
+}
+
+// Keys returns the signature keys in the key set matching a key ID.
+// If the key ID is empty, all signature keys in the key set are returned.
+func (s *JWKSService) Keys(ctx context.Context, kid string) ([]jose.JSONWebKey, error) {
+	s.mu.Lock()
+	keys := s.lookup(kid)
+	fetchedAt, fetchErr := s.fetchedAt, s.fetchErr
+	s.mu.Unlock()
+
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	if !fetchedAt.IsZero() && time.Since(fetchedAt) < s.RefreshInterval {
+		if fetchErr != nil {
+			return nil, fmt.Errorf("fetch: %w", fetchErr)
+		}
+
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if _, err := s.flight.Do(ctx, struct{}{}, s.refresh); err != nil {
+		return nil, fmt.Errorf("fetch: %w", err)
+	}
+
+	s.mu.Lock()
+	keys = s.lookup(kid)
+	s.mu.Unlock()
+
+	if len(keys) > 0 {
+		return keys, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// refresh fetches the key set and records the fetch time and error, if any.
+func (s *JWKSService) refresh(ctx context.Context) (struct{}, error) {
+	jwks, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fetchedAt = time.Now()
+	s.fetchErr = err
+
+	if err == nil {
+		s.keys = *jwks
+	}
+
+	return struct{}{}, err
+}
+
+func (s *JWKSService) lookup(kid string) []jose.JSONWebKey {
+	candidates := s.keys.Keys
+	if kid != "" {
+		candidates = s.keys.Key(kid)
+	}
+
+	keys := make([]jose.JSONWebKey, 0, len(candidates))
+
+	for _, key := range candidates {
+		if key.Use == "" || key.Use == KeyUseSignature {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (s *JWKSService) fetch(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+
+	req.Header.Set(HeaderAccept, ContentTypeJSON)
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("client request: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %q", ErrBadResponse, res.Status)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("JSON decoder: %w", err)
+	}
+
+	return &jwks, nil
+}
@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// jwksServer is a test server for a JSON Web Key Set that can be rotated or made to fail.
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     jose.JSONWebKeySet
+	status   int
+	delay    time.Duration
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, kids ...string) (*jwksServer, *JWKSService) {
+	t.Helper()
+
+	srv := &jwksServer{status: http.StatusOK} //nolint:exhaustruct
+	srv.rotate(t, kids...)
+
+	hsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		srv.requests.Add(1)
+
+		srv.mu.Lock()
+		keys, status, delay := srv.keys, srv.status, srv.delay
+		srv.mu.Unlock()
+
+		time.Sleep(delay)
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		_ = json.NewEncoder(w).Encode(keys)
+	}))
+	t.Cleanup(hsrv.Close)
+
+	srvURL, err := url.Parse(hsrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := &JWKSService{ //nolint:exhaustruct
+		Client:          hsrv.Client(),
+		URL:             *srvURL,
+		RefreshInterval: time.Minute,
+	}
+
+	return srv, jwks
+}
+
+// rotate replaces the served keys with new keys with the given key IDs.
+func (s *jwksServer) rotate(t *testing.T, kids ...string) {
+	t.Helper()
+
+	keys := make([]jose.JSONWebKey, 0, len(kids))
+
+	for _, kid := range kids {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys = append(keys, jose.JSONWebKey{ //nolint:exhaustruct
+			Key:       &key.PublicKey,
+			KeyID:     kid,
+			Algorithm: string(jose.ES256),
+			Use:       KeyUseSignature,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = jose.JSONWebKeySet{Keys: keys}
+}
+
+func (s *jwksServer) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = status
+}
+
+// expire makes the refresh interval of a key set service elapse.
+func expire(jwks *JWKSService) {
+	jwks.mu.Lock()
+	defer jwks.mu.Unlock()
+
+	jwks.fetchedAt = jwks.fetchedAt.Add(-jwks.RefreshInterval)
+}
+
+func TestJWKSServiceRotation(t *testing.T) {
+	t.Parallel()
+
+	srv, jwks := newJWKSServer(t, "k1")
+
+	steps := []struct {
+		name         string
+		kid          string
+		rotate       []string
+		expire       bool
+		wantErr      error
+		wantRequests int32
+	}{
+		{"initial fetch", "k1", nil, false, nil, 1},
+		{"cached", "k1", nil, false, nil, 1},
+		{"unknown key", "k2", nil, false, ErrUnknownKey, 1},
+		{"rotated within refresh interval", "k2", []string{"k2"}, false, ErrUnknownKey, 1},
+		{"rotated after refresh interval", "k2", nil, true, nil, 2},
+		{"old key", "k1", nil, false, ErrUnknownKey, 2},
+	}
+
+	for _, step := range steps {
+		if step.rotate != nil {
+			srv.rotate(t, step.rotate...)
+		}
+
+		if step.expire {
+			expire(jwks)
+		}
+
+		keys, err := jwks.Keys(t.Context(), step.kid)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: got error %v, want %v", step.name, err, step.wantErr)
+		}
+
+		if step.wantErr == nil && (len(keys) != 1 || keys[0].KeyID != step.kid) {
+			t.Fatalf("%s: got keys %v, want key %q", step.name, keys, step.kid)
+		}
+
+		if got := srv.requests.Load(); got != step.wantRequests {
+			t.Fatalf("%s: got %d requests, want %d", step.name, got, step.wantRequests)
+		}
+	}
+}
+
+func TestJWKSServiceFailedFetch(t *testing.T) {
+	t.Parallel()
+
+	srv, jwks := newJWKSServer(t, "k1")
+	srv.setStatus(http.StatusInternalServerError)
+
+	for range 3 {
+		if _, err := jwks.Keys(t.Context(), "k1"); !errors.Is(err, ErrBadResponse) {
+			t.Fatalf("got error %v, want %v", err, ErrBadResponse)
+		}
+	}
+
+	if got := srv.requests.Load(); got != 1 {
+		t.Fatalf("got %d requests after failed fetches, want 1", got)
+	}
+
+	srv.setStatus(http.StatusOK)
+	expire(jwks)
+
+	if _, err := jwks.Keys(t.Context(), "k1"); err != nil {
+		t.Fatalf("unexpected error after refresh interval: %v", err)
+	}
+
+	if got := srv.requests.Load(); got != 2 {
+		t.Fatalf("got %d requests, want 2", got)
+	}
+}
+
+func TestJWKSServiceConcurrentFetch(t *testing.T) {
+	t.Parallel()
+
+	srv, jwks := newJWKSServer(t, "k1")
+	srv.delay = 50 * time.Millisecond
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Go(func() {
+			if _, err := jwks.Keys(t.Context(), "k1"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if got := srv.requests.Load(); got != 1 {
+		t.Fatalf("got %d requests for concurrent callers, want 1", got)
+	}
+}
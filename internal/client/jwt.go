@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// SignatureAlgorithms is the list of accepted signature algorithms for JWT access tokens.
+//
+//nolint:gochecknoglobals
+var SignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// JWT access token types (RFC 9068), as given in the JOSE "typ" header.
+const (
+	// JWTAccessTokenType is the short JOSE type of JWT access tokens.
+	JWTAccessTokenType = "at+jwt"
+	// JWTAccessTokenMediaType is the full media type of JWT access tokens.
+	JWTAccessTokenMediaType = "application/at+jwt"
+)
+
+// JWTValidator is a local validator for JWT access tokens (RFC 9068).
+// Token signatures are verified using the keys of a JSON Web Key Set and the "typ" header and
+// the "exp", "nbf" and "iss" claims are validated, so that other JWTs signed by the issuer, such
+// as ID tokens, are not accepted as access tokens. The "typ" header is not validated if the
+// type check is skipped, for issuers that do not set it. The validation outcome is reported as
+// an [IntrospectionResponse]. Tokens that are not JWTs, are not of the access token type or
+// cannot be verified with the key set, such as opaque tokens or tokens of other issuers, are
+// validated using the fallback [Introspector] if set, otherwise they are reported as inactive.
+// If a revocation store is set, tokens issued before the revocation of their subject or session
+// ("sid" claim) are reported as inactive.
+type JWTValidator struct {
+	Keys          *JWKSService
+	Issuer        string
+	Leeway        time.Duration
+	SkipTypeCheck bool
+	Fallback      Introspector
+	Revocations   RevocationStore
+}
+
+// jwtAccessTokenClaims are the non-registered claims used from JWT access tokens.
+//
+//nolint:tagliatelle
+type jwtAccessTokenClaims struct {
+	ClientID        string `json:"client_id"`
+	AuthorizedParty string `json:"azp"`
+	Scope           string `json:"scope"`
+}
+
+// Introspect performs token validation by verifying a JWT access token locally.
+func (v *JWTValidator) Introspect(
+	ctx context.Context,
+	token, tokenTypeHint string,
+) (*IntrospectionResponse, error) {
+	jws, err := jose.ParseSignedCompact(token, SignatureAlgorithms)
+	if err != nil {
+		return v.fallback(ctx, token, tokenTypeHint)
+	}
+
+	if !v.SkipTypeCheck && !isAccessTokenType(jws) {
+		return v.fallback(ctx, token, tokenTypeHint)
+	}
+
+	payload, err := verifySignature(ctx, v.Keys, jws)
+	if errors.Is(err, ErrUnknownKey) || errors.Is(err, ErrInvalidSignature) {
+		return v.fallback(ctx, token, tokenTypeHint)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ires, err := v.validate(payload)
+	if err != nil {
+		return &IntrospectionResponse{Active: false}, nil //nolint:exhaustruct,nilerr
+	}
+
+	if v.revoked(ctx, ires) {
+		return &IntrospectionResponse{Active: false}, nil //nolint:exhaustruct
+	}
+
+	return ires, nil
+}
+
+// revoked returns whether a validated token was issued before the revocation of its subject or
+// session, treating revocation store errors and tokens without an "iat" claim as revocations.
+func (v *JWTValidator) revoked(ctx context.Context, ires *IntrospectionResponse) bool {
+	if v.Revocations == nil {
+		return false
+	}
+
+	sid, _ := ires.Claim(ClaimSessionID)
+	sidStr, _ := sid.(string)
+
+	revokedAt, err := v.Revocations.RevokedAt(ctx, RevocationKeys(ires.Subject, sidStr)...)
+	if err != nil {
+		slog.Warn("revocation store get failed", "err", err)
+
+		return true
+	}
+
+	if revokedAt.IsZero() {
+		return false
+	}
+
+	iat, _ := ires.Claim("iat")
+	num, _ := iat.(json.Number)
+
+	secs, err := num.Int64()
+	if err != nil {
+		return true
+	}
+
+	return !revokedAt.Before(time.Unix(secs, 0))
+}
+
+// fallback validates a token that cannot be validated locally using the fallback [Introspector]
+// if set, otherwise the token is reported as inactive.
+func (v *JWTValidator) fallback(
+	ctx context.Context,
+	token, tokenTypeHint string,
+) (*IntrospectionResponse, error) {
+	if v.Fallback != nil {
+		return v.Fallback.Introspect(ctx, token, tokenTypeHint) //nolint:wrapcheck
+	}
+
+	return &IntrospectionResponse{Active: false}, nil //nolint:exhaustruct
+}
+
+func (v *JWTValidator) validate(payload []byte) (*IntrospectionResponse, error) {
+	var (
+		claims   jwt.Claims
+		atClaims jwtAccessTokenClaims
+	)
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	if err := json.Unmarshal(payload, &atClaims); err != nil {
+		return nil, fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	if err := v.validClaims(&claims); err != nil {
+		return nil, fmt.Errorf("validate claims: %w", err)
+	}
+
+	allClaims, err := decodeClaims(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+
+	clientID := atClaims.ClientID
+	if clientID == "" {
+		clientID = atClaims.AuthorizedParty
+	}
+
+	ires := &IntrospectionResponse{
+		Active:   true,
+		ClientID: clientID,
+		Scope:    atClaims.Scope,
+		Subject:  claims.Subject,
+		Audience: Audience(claims.Audience),
+		Expiry:   claims.Expiry,
+		Claims:   allClaims,
+	}
+
+	return ires, nil
+}
+
+func (v *JWTValidator) validClaims(claims *jwt.Claims) error {
+	if claims.Expiry == nil {
+		return fmt.Errorf("%w: exp", ErrMissingClaim)
+	}
+
+	expected := jwt.Expected{ //nolint:exhaustruct
+		Issuer: v.Issuer,
+		Time:   time.Now(),
+	}
+
+	return claims.ValidateWithLeeway(expected, v.Leeway) //nolint:wrapcheck
+}
+
+// isAccessTokenType returns whether the "typ" header of a JWS is the JWT access token type.
+func isAccessTokenType(jws *jose.JSONWebSignature) bool {
+	typ, _ := jws.Signatures[0].Header.ExtraHeaders[jose.HeaderType].(string)
+
+	return strings.EqualFold(typ, JWTAccessTokenType) ||
+		strings.EqualFold(typ, JWTAccessTokenMediaType)
+}
+
+// verifySignature verifies the signature of a JWS using the keys of a JSON Web Key Set
+// and returns its payload.
+func verifySignature(
+	ctx context.Context,
+	keys *JWKSService,
+	jws *jose.JSONWebSignature,
+) ([]byte, error) {
+	candidates, err := keys.Keys(ctx, jws.Signatures[0].Header.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS keys: %w", err)
+	}
+
+	for _, key := range candidates {
+		if payload, err := jws.Verify(key); err == nil {
+			return payload, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func TestJWTValidatorType(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+
+	claims := map[string]any{
+		"iss": testIssuer,
+		"sub": "alice",
+		"aud": "client",
+		"exp": jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+
+	idClaims := map[string]any{
+		"iss":   testIssuer,
+		"sub":   "alice",
+		"aud":   "client",
+		"exp":   jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		"nonce": "n-0S6_WzA2Mj",
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		skipTypeCheck bool
+		wantActive    bool
+	}{
+		{"access token", keys.sign(t, JWTAccessTokenType, claims), false, true},
+		{"access token media type", keys.sign(t, JWTAccessTokenMediaType, claims), false, true},
+		{"ID token", keys.sign(t, "JWT", idClaims), false, false},
+		{"no type", keys.sign(t, "", claims), false, false},
+		{"ID token without type check", keys.sign(t, "JWT", idClaims), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := &JWTValidator{ //nolint:exhaustruct
+				Keys:          keys.jwks,
+				Issuer:        testIssuer,
+				SkipTypeCheck: tt.skipTypeCheck,
+			}
+
+			ires, err := v.Introspect(t.Context(), tt.token, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ires.Active != tt.wantActive {
+				t.Fatalf("got active %t, want %t", ires.Active, tt.wantActive)
+			}
+		})
+	}
+}
+
+// countingIntrospector is an introspector counting its introspections.
+type countingIntrospector struct {
+	calls atomic.Int32
+}
+
+func (c *countingIntrospector) Introspect(
+	_ context.Context,
+	_, _ string,
+) (*IntrospectionResponse, error) {
+	c.calls.Add(1)
+
+	return &IntrospectionResponse{Active: true}, nil //nolint:exhaustruct
+}
+
+func TestJWTValidatorFallback(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+	other := newTestKeys(t)
+
+	claims := map[string]any{
+		"iss": testIssuer,
+		"sub": "alice",
+		"exp": jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+
+	valid := keys.sign(t, JWTAccessTokenType, claims)
+	otherKID := keys.signWithKeyID(t, "other", JWTAccessTokenType, claims)
+
+	tests := []struct {
+		name          string
+		token         string
+		wantFallbacks int32
+		wantActive    bool
+	}{
+		{"valid", valid, 0, true},
+		{"opaque", "opaque-token", 1, true},
+		{"wrong type", keys.sign(t, "JWT", claims), 1, true},
+		{"unknown key ID", otherKID, 1, true},
+		{"bad signature", other.sign(t, JWTAccessTokenType, claims), 1, true},
+		{"expired", keys.sign(t, JWTAccessTokenType, map[string]any{
+			"iss": testIssuer,
+			"exp": jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		}), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fallback := &countingIntrospector{} //nolint:exhaustruct
+			v := &JWTValidator{                 //nolint:exhaustruct
+				Keys:     keys.jwks,
+				Issuer:   testIssuer,
+				Fallback: fallback,
+			}
+
+			ires, err := v.Introspect(t.Context(), tt.token, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := fallback.calls.Load()
+			if got != tt.wantFallbacks || ires.Active != tt.wantActive {
+				t.Fatalf(
+					"got %d fallbacks and active %t, want %d and %t",
+					got,
+					ires.Active,
+					tt.wantFallbacks,
+					tt.wantActive,
+				)
+			}
+		})
+	}
+}
+
+func TestJWTValidatorRevocations(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+	now := time.Now()
+
+	revs := NewMemoryRevocationStore(t.Context(), time.Hour)
+	if err := revs.Revoke(t.Context(), RevocationKeyPrefixSession+"s1", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := revs.Revoke(t.Context(), RevocationKeyPrefixSubject+"bob", now); err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(sub, sid string, iat time.Time) string {
+		claims := map[string]any{
+			"iss": testIssuer,
+			"sub": sub,
+			"sid": sid,
+			"exp": jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+		if !iat.IsZero() {
+			claims["iat"] = jwt.NewNumericDate(iat)
+		}
+
+		return keys.sign(t, JWTAccessTokenType, claims)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantActive bool
+	}{
+		{"unrevoked", token("alice", "s2", now.Add(-time.Minute)), true},
+		{"revoked session", token("alice", "s1", now.Add(-time.Minute)), false},
+		{"revoked subject", token("bob", "s3", now.Add(-time.Minute)), false},
+		{"issued after revocation", token("bob", "s4", now.Add(2*time.Second)), true},
+		{"revoked without iat", token("bob", "s5", time.Time{}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := &JWTValidator{ //nolint:exhaustruct
+				Keys:        keys.jwks,
+				Issuer:      testIssuer,
+				Leeway:      time.Minute,
+				Revocations: revs,
+			}
+
+			ires, err := v.Introspect(t.Context(), tt.token, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ires.Active != tt.wantActive {
+				t.Fatalf("got active %t, want %t", ires.Active, tt.wantActive)
+			}
+		})
+	}
+}
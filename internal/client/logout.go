@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	// EventBackChannelLogout is the event type of OIDC Back-Channel Logout tokens.
+	EventBackChannelLogout = "http://schemas.openid.net/event/backchannel-logout"
+	// ClaimSessionID is the claim identifying the session of a user at the OpenID Provider.
+	ClaimSessionID = "sid"
+	// LogoutTokenReplayCacheSize is the maximum number of remembered logout tokens for
+	// detecting replays.
+	LogoutTokenReplayCacheSize = 10000
+)
+
+// LogoutClaims are the claims identifying the user and the session at the OpenID Provider
+// in ID tokens and logout tokens.
+//
+//nolint:tagliatelle
+type LogoutClaims struct {
+	Subject   string `json:"sub,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// LogoutTokenValidator is a validator for OIDC Back-Channel Logout tokens.
+// Token signatures are verified using the keys of a JSON Web Key Set and the "iss", "aud",
+// "iat", "exp", "jti" and "events" claims are validated. The "jti" claims of valid tokens are
+// remembered until the tokens expire in a replay cache of bounded size, so that tokens cannot
+// be reused.
+type LogoutTokenValidator struct {
+	Keys     *JWKSService
+	Issuer   string
+	ClientID string
+	Leeway   time.Duration
+
+	replays     *replayCache
+	replaysOnce sync.Once
+}
+
+//nolint:tagliatelle
+type logoutTokenClaims struct {
+	LogoutClaims
+
+	Events map[string]json.RawMessage `json:"events"`
+	Nonce  json.RawMessage            `json:"nonce"`
+}
+
+// IDTokenLogoutClaims returns the logout claims of the ID token in a token response.
+// ID tokens are obtained directly from the token endpoint, therefore their signatures are not
+// verified as allowed by OpenID Connect Core 1.0, Section 3.1.3.7.
+func (r *TokenResponse) IDTokenLogoutClaims() (*LogoutClaims, error) {
+	if r.IDToken == "" {
+		return &LogoutClaims{}, nil //nolint:exhaustruct
+	}
+
+	tok, err := jwt.ParseSigned(r.IDToken, SignatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("JWT parser: %w", err)
+	}
+
+	var claims LogoutClaims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, fmt.Errorf("JWT claims: %w", err)
+	}
+
+	return &claims, nil
+}
+
+// Validate validates a logout token and returns its logout claims.
+func (v *LogoutTokenValidator) Validate(ctx context.Context, token string) (*LogoutClaims, error) {
+	jws, err := jose.ParseSignedCompact(token, SignatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLogoutToken, err)
+	}
+
+	payload, err := verifySignature(ctx, v.Keys, jws)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLogoutToken, err)
+	}
+
+	var (
+		claims   jwt.Claims
+		ltClaims logoutTokenClaims
+	)
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: JSON unmarshal: %w", ErrInvalidLogoutToken, err)
+	}
+
+	if err := json.Unmarshal(payload, &ltClaims); err != nil {
+		return nil, fmt.Errorf("%w: JSON unmarshal: %w", ErrInvalidLogoutToken, err)
+	}
+
+	if err := v.validClaims(&claims, &ltClaims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLogoutToken, err)
+	}
+
+	v.replaysOnce.Do(func() { v.replays = newReplayCache(LogoutTokenReplayCacheSize) })
+
+	added, err := v.replays.add(claims.ID, claims.Expiry.Time().Add(v.Leeway), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLogoutToken, err)
+	}
+
+	if !added {
+		return nil, fmt.Errorf("%w: %w: jti", ErrInvalidLogoutToken, ErrReplayedToken)
+	}
+
+	return &ltClaims.LogoutClaims, nil
+}
+
+func (v *LogoutTokenValidator) validClaims(claims *jwt.Claims, ltClaims *logoutTokenClaims) error {
+	if claims.IssuedAt == nil {
+		return fmt.Errorf("%w: iat", ErrMissingClaim)
+	}
+
+	if claims.Expiry == nil {
+		return fmt.Errorf("%w: exp", ErrMissingClaim)
+	}
+
+	if claims.ID == "" {
+		return fmt.Errorf("%w: jti", ErrMissingClaim)
+	}
+
+	if _, ok := ltClaims.Events[EventBackChannelLogout]; !ok {
+		return fmt.Errorf("%w: events", ErrMissingClaim)
+	}
+
+	if claims.Subject == "" && ltClaims.SessionID == "" {
+		return fmt.Errorf("%w: sub or sid", ErrMissingClaim)
+	}
+
+	if ltClaims.Nonce != nil {
+		return fmt.Errorf("%w: nonce", ErrUnexpectedClaim)
+	}
+
+	expected := jwt.Expected{ //nolint:exhaustruct
+		Issuer:      v.Issuer,
+		AnyAudience: jwt.Audience{v.ClientID},
+		Time:        time.Now(),
+	}
+
+	return claims.ValidateWithLeeway(expected, v.Leeway) //nolint:wrapcheck
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func TestLogoutTokenValidator(t *testing.T) {
+	t.Parallel()
+
+	keys := newTestKeys(t)
+
+	v := &LogoutTokenValidator{ //nolint:exhaustruct
+		Keys:     keys.jwks,
+		Issuer:   testIssuer,
+		ClientID: "client",
+		Leeway:   time.Second,
+	}
+
+	now := time.Now()
+	claims := func(jti string, exp bool) map[string]any {
+		c := map[string]any{
+			"iss":    testIssuer,
+			"aud":    "client",
+			"sub":    "alice",
+			"iat":    jwt.NewNumericDate(now),
+			"events": map[string]any{EventBackChannelLogout: map[string]any{}},
+		}
+
+		if jti != "" {
+			c["jti"] = jti
+		}
+
+		if exp {
+			c["exp"] = jwt.NewNumericDate(now.Add(time.Minute))
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"valid", keys.sign(t, "logout+jwt", claims("a", true)), nil},
+		{"replayed", keys.sign(t, "logout+jwt", claims("a", true)), ErrReplayedToken},
+		{"missing exp", keys.sign(t, "logout+jwt", claims("b", false)), ErrMissingClaim},
+		{"missing jti", keys.sign(t, "logout+jwt", claims("", true)), ErrMissingClaim},
+	}
+
+	for _, tt := range tests { //nolint:paralleltest
+		t.Run(tt.name, func(t *testing.T) {
+			lclaims, err := v.Validate(t.Context(), tt.token)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if lclaims.Subject != "alice" {
+					t.Fatalf("got subject %q, want %q", lclaims.Subject, "alice")
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidLogoutToken) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
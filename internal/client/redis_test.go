@@ -0,0 +1,364 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-process server implementing the subset of the Redis protocol (RESP2) used
+// by the Redis-backed stores: the GET, SET (with the PX and EX options) and MGET commands.
+type fakeRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T) (*fakeRedis, *redis.Client) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fakeRedis{values: map[string]string{}, expires: map[string]time.Time{}}
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go srv.serve(conn)
+		}
+	}()
+
+	rdb := redis.NewClient(&redis.Options{Addr: lis.Addr().String()}) //nolint:exhaustruct
+
+	t.Cleanup(func() {
+		_ = rdb.Close()
+		_ = lis.Close()
+	})
+
+	return srv, rdb
+}
+
+// ttl returns the remaining time to live of a key, or zero if the key has no expiration.
+func (s *fakeRedis) ttl(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if exp, ok := s.expires[key]; ok {
+		return time.Until(exp)
+	}
+
+	return 0
+}
+
+// keys returns the stored keys.
+func (s *fakeRedis) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	rd := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+
+		if _, err := io.WriteString(conn, s.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) exec(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if val, ok := s.get(args[1]); ok {
+			return bulkString(val)
+		}
+
+		return "$-1\r\n"
+	case "MGET":
+		reply := fmt.Sprintf("*%d\r\n", len(args)-1)
+
+		for _, key := range args[1:] {
+			if val, ok := s.get(key); ok {
+				reply += bulkString(val)
+			} else {
+				reply += "$-1\r\n"
+			}
+		}
+
+		return reply
+	case "SET":
+		s.values[args[1]] = args[2]
+		delete(s.expires, args[1])
+
+		for idx := 3; idx+1 < len(args); idx += 2 {
+			num, err := strconv.ParseInt(args[idx+1], 10, 64)
+			if err != nil {
+				return "-ERR value is not an integer\r\n"
+			}
+
+			switch strings.ToUpper(args[idx]) {
+			case "PX":
+				s.expires[args[1]] = time.Now().Add(time.Duration(num) * time.Millisecond)
+			case "EX":
+				s.expires[args[1]] = time.Now().Add(time.Duration(num) * time.Second)
+			}
+		}
+
+		return "+OK\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func (s *fakeRedis) get(key string) (string, bool) {
+	if exp, ok := s.expires[key]; ok && !time.Now().Before(exp) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+
+	val, ok := s.values[key]
+
+	return val, ok
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return nil, errors.New("expected array") //nolint:err113
+	}
+
+	num, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	args := make([]string, 0, num)
+
+	for range num {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		buf := make([]byte, size+2) //nolint:mnd
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func bulkString(val string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(val), val)
+}
+
+func TestRedisIntrospectionCache(t *testing.T) {
+	t.Parallel()
+
+	srv, rdb := newFakeRedis(t)
+	icache := &RedisIntrospectionCache{Client: rdb, Prefix: "fwdauth:ic:"}
+
+	hasher, err := NewTokenHasher([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := hasher.CacheKey("token", "")
+	now := time.Now().Truncate(time.Second)
+
+	var ires IntrospectionResponse
+	if err := json.Unmarshal([]byte(`{
+		"active": true,
+		"sub": "alice",
+		"aud": ["api1", "api2"],
+		"exp": `+strconv.FormatInt(now.Add(time.Hour).Unix(), 10)+`,
+		"realm": {"roles": ["admin"]},
+		"level": 3
+	}`), &ires); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &IntrospectionCacheEntry{ //nolint:exhaustruct
+		Response: &ires,
+		Created:  now,
+		Expires:  now.Add(time.Minute),
+	}
+
+	if got, err := icache.Get(t.Context(), key); err != nil || got != nil {
+		t.Fatalf("got entry %v and error %v before set, want none", got, err)
+	}
+
+	if err := icache.Set(t.Context(), key, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := srv.keys(); len(keys) != 1 || !strings.HasPrefix(keys[0], "fwdauth:ic:") {
+		t.Fatalf("got keys %q, want one key with prefix %q", keys, "fwdauth:ic:")
+	}
+
+	if ttl := srv.ttl(srv.keys()[0]); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("got TTL %v, want up to %v", ttl, time.Minute)
+	}
+
+	got, err := icache.Get(t.Context(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Created.Equal(entry.Created) || !got.Expires.Equal(entry.Expires) {
+		t.Fatalf(
+			"got times %v/%v, want %v/%v",
+			got.Created,
+			got.Expires,
+			entry.Created,
+			entry.Expires,
+		)
+	}
+
+	gres := got.Response
+	if !gres.Active || gres.Subject != "alice" || strings.Join(gres.Audience, " ") != "api1 api2" {
+		t.Fatalf("got response %+v, want %+v", gres, ires)
+	}
+
+	if gres.Expiry == nil || *gres.Expiry != *jwt.NewNumericDate(now.Add(time.Hour)) {
+		t.Fatalf("got expiry %v, want %v", gres.Expiry, now.Add(time.Hour))
+	}
+
+	if roles, _ := gres.Claim("realm.roles"); fmt.Sprint(roles) != "[admin]" {
+		t.Fatalf("got realm.roles claim %v, want [admin]", roles)
+	}
+
+	if level, _ := gres.Claim("level"); level != json.Number("3") {
+		t.Fatalf("got level claim %#v, want %#v", level, json.Number("3"))
+	}
+}
+
+func TestRedisIntrospectionCacheExpired(t *testing.T) {
+	t.Parallel()
+
+	srv, rdb := newFakeRedis(t)
+	icache := &RedisIntrospectionCache{Client: rdb, Prefix: "fwdauth:ic:"}
+
+	hasher, err := NewTokenHasher(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &IntrospectionCacheEntry{ //nolint:exhaustruct
+		Error:   "boom",
+		Created: time.Now().Add(-time.Minute),
+		Expires: time.Now().Add(-time.Second),
+	}
+
+	if err := icache.Set(t.Context(), hasher.CacheKey("token", ""), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := srv.keys(); len(keys) != 0 {
+		t.Fatalf("got keys %q for an expired entry, want none", keys)
+	}
+}
+
+func TestRedisRevocationStore(t *testing.T) {
+	t.Parallel()
+
+	srv, rdb := newFakeRedis(t)
+	store := &RedisRevocationStore{Client: rdb, Prefix: "fwdauth:rev:", Retention: time.Hour}
+
+	if at, err := store.RevokedAt(t.Context(), RevocationKeys("alice", "sid1")...); err != nil ||
+		!at.IsZero() {
+		t.Fatalf("got revocation time %v and error %v before revoke, want none", at, err)
+	}
+
+	first := time.Now().Add(-time.Minute)
+	second := time.Now()
+
+	if err := store.Revoke(t.Context(), RevocationKeyPrefixSubject+"alice", first); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Revoke(t.Context(), RevocationKeyPrefixSession+"sid1", second); err != nil {
+		t.Fatal(err)
+	}
+
+	rkey := "fwdauth:rev:" + RevocationKeyPrefixSubject + "alice"
+	if ttl := srv.ttl(rkey); ttl <= time.Hour-time.Minute || ttl > time.Hour {
+		t.Fatalf("got TTL %v for key %q, want %v", ttl, rkey, time.Hour)
+	}
+
+	tests := []struct {
+		name string
+		keys []string
+		want time.Time
+	}{
+		{"no keys", nil, time.Time{}},
+		{"subject", RevocationKeys("alice", ""), first},
+		{"latest", RevocationKeys("alice", "sid1"), second},
+		{"unrevoked", RevocationKeys("bob", "sid2"), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			at, err := store.RevokedAt(t.Context(), tt.keys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !at.Equal(tt.want) {
+				t.Fatalf("got revocation time %v, want %v", at, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// replayCache is a cache of seen keys, which are remembered until they expire.
+// When the cache is full, the oldest key is forgotten if it has expired, otherwise new keys are
+// rejected, so that flooding the cache cannot evict keys that could still be replayed.
+type replayCache struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	order []replayEntry
+	next  int
+}
+
+type replayEntry struct {
+	key     string
+	expires time.Time
+}
+
+// newReplayCache creates a new replay cache remembering up to size keys.
+func newReplayCache(size int) *replayCache {
+	c := &replayCache{ //nolint:exhaustruct
+		seen:  make(map[string]time.Time, size),
+		order: make([]replayEntry, 0, size),
+	}
+
+	return c
+}
+
+// add remembers a key until it expires, unless the key is already remembered.
+// It returns whether the key was added, or [ErrReplayCacheFull] if the cache is full.
+func (c *replayCache) add(key string, expires, now time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if exp, ok := c.seen[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+
+	ent := replayEntry{key: key, expires: expires}
+
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, ent)
+	} else if len(c.order) > 0 {
+		old := c.order[c.next]
+		if now.Before(old.expires) {
+			return false, ErrReplayCacheFull
+		}
+
+		if c.seen[old.key] == old.expires {
+			delete(c.seen, old.key)
+		}
+
+		c.order[c.next] = ent
+		c.next = (c.next + 1) % len(c.order)
+	}
+
+	c.seen[key] = expires
+
+	return true, nil
+}
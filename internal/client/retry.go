@@ -0,0 +1,210 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/metrics"
+)
+
+const (
+	// HeaderRetryAfter is the HTTP response header with the time to wait before retrying.
+	HeaderRetryAfter = "Retry-After"
+)
+
+// RetryPolicy is a policy for retrying failed requests to idempotent endpoints.
+//
+// Requests are retried on connection errors and on the 429, 502, 503 and 504 status codes,
+// waiting between attempts with exponential backoff and full jitter, or for the time given in
+// the Retry-After response header if any. Requests are not retried on TLS certificate errors,
+// which are not transient, or when the wait would exceed the maximum delay or the context
+// deadline. A nil policy does not retry requests.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first attempt.
+	MaxAttempts int
+	// BaseDelay is the maximum delay before the first retry, doubled for each further retry.
+	BaseDelay time.Duration
+	// MaxDelay is the maximum delay between attempts.
+	MaxDelay time.Duration
+}
+
+// Do sends the requests created by newRequest using a client until an attempt succeeds or
+// cannot be retried, and returns the response of the last attempt. A new request is created
+// for each attempt. Attempts are counted in the metrics for the given endpoint name.
+func (p *RetryPolicy) Do(
+	ctx context.Context,
+	clnt *http.Client,
+	endpoint string,
+	newRequest func() (*http.Request, error),
+) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		res, err := clnt.Do(req) //nolint:bodyclose
+
+		observeAttempt(endpoint, res, start)
+
+		delay, ok := p.retryDelay(attempt, res, err)
+		if ok {
+			ok = waitable(ctx, delay)
+		}
+
+		if !ok {
+			if err != nil {
+				return nil, fmt.Errorf("client request: %w", err)
+			}
+
+			return res, nil
+		}
+
+		if res != nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+
+		metrics.ClientRetriesTotal.WithLabelValues(endpoint).Inc()
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, fmt.Errorf("retry wait: %w", context.Cause(ctx))
+		}
+	}
+}
+
+// retryDelay returns the delay before retrying an attempt and whether it can be retried.
+func (p *RetryPolicy) retryDelay(attempt int, res *http.Response, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if err != nil {
+		if !isConnectionError(err) {
+			return 0, false
+		}
+	} else {
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+		default:
+			return 0, false
+		}
+
+		if delay, ok := retryAfter(res.Header.Get(HeaderRetryAfter)); ok {
+			return delay, delay <= p.MaxDelay
+		}
+	}
+
+	backoff := min(p.BaseDelay, p.MaxDelay)
+	for range attempt - 1 {
+		if backoff > p.MaxDelay/2 { //nolint:mnd
+			backoff = p.MaxDelay
+
+			break
+		}
+
+		backoff *= 2
+	}
+
+	if backoff <= 0 {
+		return 0, true
+	}
+
+	return rand.N(backoff + 1), true //nolint:gosec
+}
+
+// isConnectionError returns whether a client request error is a connection-level error, such
+// as a refused or reset connection or a network timeout. Context errors and TLS certificate
+// verification errors, including public key pin mismatches, are not connection-level errors.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrPinMismatch) {
+		return false
+	}
+
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		alertErr     tls.AlertError
+		recordErr    tls.RecordHeaderError
+	)
+
+	if errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &alertErr) || errors.As(err, &recordErr) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Client errors are wrapped in URL errors, which are network errors themselves.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr)
+}
+
+// retryAfter parses a Retry-After response header value, either in seconds or as an HTTP date.
+func retryAfter(val string) (time.Duration, bool) {
+	if val == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(val); err == nil {
+		return max(time.Until(t), 0), true
+	}
+
+	return 0, false
+}
+
+// waitable returns whether a context deadline, if any, allows waiting for a delay.
+func waitable(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+
+	return !ok || time.Now().Add(delay).Before(deadline)
+}
+
+func observeAttempt(endpoint string, res *http.Response, start time.Time) {
+	code := "error"
+	if res != nil {
+		code = strconv.Itoa(res.StatusCode)
+	}
+
+	metrics.ClientAttemptsTotal.WithLabelValues(endpoint, code).Inc()
+	metrics.ClientAttemptDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{
+		MaxAttempts: 1000,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{6, 5 * time.Second},
+		{64, 5 * time.Second},
+		{999, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		var longest time.Duration
+
+		for range 100 {
+			delay, ok := policy.retryDelay(tt.attempt, nil, syscall.ECONNREFUSED)
+			if !ok {
+				t.Fatalf("attempt %d: not retried", tt.attempt)
+			}
+
+			if delay < 0 || delay > tt.max {
+				t.Fatalf("attempt %d: got delay %v, want up to %v", tt.attempt, delay, tt.max)
+			}
+
+			longest = max(longest, delay)
+		}
+
+		if longest <= tt.max/2 {
+			t.Fatalf(
+				"attempt %d: got longest delay %v, want over %v",
+				tt.attempt,
+				longest,
+				tt.max/2,
+			)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	t.Parallel()
+
+	tlsSrv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	tlsSrv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsSrv.StartTLS()
+	t.Cleanup(tlsSrv.Close)
+
+	unavailable := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	t.Cleanup(unavailable.Close)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refusedURL := "http://" + lis.Addr().String()
+	_ = lis.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(tlsSrv.Certificate())
+
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: 0, MaxDelay: 0}
+
+	tests := []struct {
+		name         string
+		cfg          *ClientConfig
+		url          string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"trusted", &ClientConfig{RootCAs: pool}, tlsSrv.URL, false, 1}, //nolint:exhaustruct
+		{"untrusted certificate", &ClientConfig{}, tlsSrv.URL, true, 1}, //nolint:exhaustruct
+		{
+			"pin mismatch",
+			&ClientConfig{RootCAs: pool, Pins: []string{"bm9wZQ=="}}, //nolint:exhaustruct
+			tlsSrv.URL,
+			true,
+			1,
+		},
+		{"connection refused", &ClientConfig{}, refusedURL, true, 3}, //nolint:exhaustruct
+		{"unavailable", &ClientConfig{}, unavailable.URL, false, 3},  //nolint:exhaustruct
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			clnt := NewClient(tt.cfg)
+			attempts := 0
+
+			res, err := policy.Do(t.Context(), clnt, "test", func() (*http.Request, error) {
+				attempts++
+
+				return http.NewRequestWithContext(t.Context(), http.MethodGet, tt.url, nil)
+			})
+			if err == nil {
+				_ = res.Body.Close()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/twmb/go-cache/cache"
+)
+
+// Revocation key prefixes.
+const (
+	// RevocationKeyPrefixSubject is the prefix of revocation keys for subjects.
+	RevocationKeyPrefixSubject = "sub:"
+	// RevocationKeyPrefixSession is the prefix of revocation keys for sessions.
+	RevocationKeyPrefixSession = "sid:"
+)
+
+// RevocationStore is a store of revocation times, used for invalidating sessions and cached
+// introspection outcomes of users logged out at the OpenID Provider.
+type RevocationStore interface {
+	// Revoke records the revocation of a key at a given time.
+	Revoke(ctx context.Context, key string, at time.Time) error
+	// RevokedAt returns the latest revocation time of any of the keys,
+	// or the zero time if none of the keys are revoked.
+	RevokedAt(ctx context.Context, keys ...string) (time.Time, error)
+}
+
+// MemoryRevocationStore is an in-memory [RevocationStore].
+type MemoryRevocationStore struct {
+	cache *cache.Cache[string, time.Time]
+}
+
+// RedisRevocationStore is a [RevocationStore] using a server compatible with the Redis protocol,
+// e.g. Redis or Valkey, allowing revocations to be shared across instances.
+// Revocations are kept for the configured retention time.
+type RedisRevocationStore struct {
+	Client    *redis.Client
+	Prefix    string
+	Retention time.Duration
+}
+
+// RevocationKeys returns the revocation keys for a subject and a session ID.
+// Empty values are omitted.
+func RevocationKeys(subject, sessionID string) []string {
+	var keys []string
+
+	if subject != "" {
+		keys = append(keys, RevocationKeyPrefixSubject+subject)
+	}
+
+	if sessionID != "" {
+		keys = append(keys, RevocationKeyPrefixSession+sessionID)
+	}
+
+	return keys
+}
+
+// NewMemoryRevocationStore creates a new in-memory revocation store.
+// The retention is the time for keeping revocations, which should be at least as long as the
+// lifetime of sessions and cached introspection outcomes.
+func NewMemoryRevocationStore(ctx context.Context, retention time.Duration) *MemoryRevocationStore {
+	rcache := cache.New[string, time.Time](
+		cache.AutoCleanInterval(retention/2), //nolint:mnd
+		cache.MaxAge(retention),
+	)
+
+	go func() {
+		<-ctx.Done()
+		rcache.StopAutoClean()
+	}()
+
+	return &MemoryRevocationStore{cache: rcache}
+}
+
+// Revoke records the revocation of a key at a given time.
+func (s *MemoryRevocationStore) Revoke(_ context.Context, key string, at time.Time) error {
+	if prev, _, ks := s.cache.TryGet(key); ks == cache.Hit && prev.After(at) {
+		return nil
+	}
+
+	s.cache.Set(key, at)
+
+	return nil
+}
+
+// RevokedAt returns the latest revocation time of any of the keys,
+// or the zero time if none of the keys are revoked.
+func (s *MemoryRevocationStore) RevokedAt(_ context.Context, keys ...string) (time.Time, error) {
+	var revokedAt time.Time
+
+	for _, key := range keys {
+		if at, _, ks := s.cache.TryGet(key); ks == cache.Hit && at.After(revokedAt) {
+			revokedAt = at
+		}
+	}
+
+	return revokedAt, nil
+}
+
+// Revoke records the revocation of a key at a given time.
+func (s *RedisRevocationStore) Revoke(ctx context.Context, key string, at time.Time) error {
+	val := strconv.FormatInt(at.UnixNano(), 10)
+
+	if err := s.Client.Set(ctx, s.Prefix+key, val, s.Retention).Err(); err != nil {
+		return fmt.Errorf("redis set: %w", err)
+	}
+
+	return nil
+}
+
+// RevokedAt returns the latest revocation time of any of the keys,
+// or the zero time if none of the keys are revoked.
+func (s *RedisRevocationStore) RevokedAt(ctx context.Context, keys ...string) (time.Time, error) {
+	var revokedAt time.Time
+
+	if len(keys) == 0 {
+		return revokedAt, nil
+	}
+
+	rkeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		rkeys = append(rkeys, s.Prefix+key)
+	}
+
+	vals, err := s.Client.MGet(ctx, rkeys...).Result()
+	if err != nil {
+		return revokedAt, fmt.Errorf("redis mget: %w", err)
+	}
+
+	for _, val := range vals {
+		str, ok := val.(string)
+		if !ok {
+			continue
+		}
+
+		nsec, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return revokedAt, fmt.Errorf("parse int: %w", err)
+		}
+
+		if at := time.Unix(0, nsec); at.After(revokedAt) {
+			revokedAt = at
+		}
+	}
+
+	return revokedAt, nil
+}
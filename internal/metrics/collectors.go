@@ -76,3 +76,110 @@ var AuthRequestDuration = promauto.NewHistogramVec(
 	},
 	[]string{"code"},
 )
+
+// AuthTokenSourcesTotal is the collector for the total number of tokens by source.
+//
+//nolint:gochecknoglobals
+var AuthTokenSourcesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace:   Namespace,
+		Subsystem:   "auth",
+		Name:        "token_sources_total",
+		Help:        "Total number of tokens by source in the Traefik Forward Auth service.",
+		ConstLabels: prometheus.Labels{},
+	},
+	[]string{"source"},
+)
+
+// IntrospectionCacheHitsTotal is the collector for the total number of introspection cache hits.
+//
+//nolint:gochecknoglobals
+var IntrospectionCacheHitsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "introspection",
+		Name:      "cache_hits_total",
+		Help: "Total number of introspection cache hits in the " +
+			"Traefik Forward Auth service.",
+		ConstLabels: prometheus.Labels{},
+	},
+	[]string{"outcome"},
+)
+
+// IntrospectionCacheMissesTotal is the collector for the total number of introspection cache misses.
+//
+//nolint:gochecknoglobals
+var IntrospectionCacheMissesTotal = promauto.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "introspection",
+		Name:      "cache_misses_total",
+		Help: "Total number of introspection cache misses in the " +
+			"Traefik Forward Auth service.",
+		ConstLabels: prometheus.Labels{},
+	},
+)
+
+// ClientAttemptsTotal is the collector for the total number of request attempts to the
+// identity provider.
+//
+//nolint:gochecknoglobals
+var ClientAttemptsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "client",
+		Name:      "attempts_total",
+		Help: "Total number of request attempts to the identity provider in the " +
+			"Traefik Forward Auth service.",
+		ConstLabels: prometheus.Labels{},
+	},
+	[]string{"endpoint", "code"},
+)
+
+// ClientAttemptDuration is the collector for the distribution of request attempt durations to the
+// identity provider.
+//
+//nolint:exhaustruct,gochecknoglobals
+var ClientAttemptDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "client",
+		Name:      "attempt_duration_seconds",
+		Help: "Distribution of request attempt durations to the identity provider in the " +
+			"Traefik Forward Auth service.",
+		Buckets:     []float64{.05, .1, .2, .4, 1, 3, 8, 20, 60},
+		ConstLabels: prometheus.Labels{},
+	},
+	[]string{"endpoint"},
+)
+
+// ClientRetriesTotal is the collector for the total number of retried requests to the
+// identity provider.
+//
+//nolint:gochecknoglobals
+var ClientRetriesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "client",
+		Name:      "retries_total",
+		Help: "Total number of retried requests to the identity provider in the " +
+			"Traefik Forward Auth service.",
+		ConstLabels: prometheus.Labels{},
+	},
+	[]string{"endpoint"},
+)
+
+// IntrospectionCircuitState is the collector for the state of the introspection circuit breakers.
+//
+//nolint:gochecknoglobals
+var IntrospectionCircuitState = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "introspection",
+		Name:      "circuit_state",
+		Help: "State of the introspection circuit breakers (0 closed, 1 half-open, 2 open) " +
+			"in the Traefik Forward Auth service.",
+		ConstLabels: prometheus.Labels{},
+	},
+	[]string{"issuer"},
+)
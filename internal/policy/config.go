@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is a set of named authorization policies and rules for selecting them.
+type Config struct {
+	// Policies are the authorization policies by name.
+	Policies map[string]*Policy `yaml:"policies"`
+	// Rules are the policy selection rules, evaluated in order.
+	Rules []*Rule `yaml:"rules"`
+	// DefaultPolicy is the name of the policy selected for requests not matching any rule.
+	// If not set, requests not matching any rule are denied when rules are configured.
+	DefaultPolicy string `yaml:"default_policy"`
+}
+
+// Rule selects a named policy for requests matching a method, a host, a path prefix and a path
+// pattern. Empty rule fields match any value. Request paths are decoded and cleaned, and paths
+// are matched case-insensitively, so that equivalent paths cannot bypass rules. A path pattern
+// ending in "/*" also matches the path without the trailing "/*", e.g. "/orders/*" matches
+// "/orders".
+type Rule struct {
+	// Methods are the request methods to match.
+	Methods []string `yaml:"methods"`
+	// Host is the request host to match. A leading "*." matches any subdomain.
+	Host string `yaml:"host"`
+	// PathPrefix is the request path prefix to match.
+	PathPrefix string `yaml:"path_prefix"`
+	// Path is the request path pattern to match, where "*" matches any sequence of characters,
+	// e.g. "/orders/*".
+	Path string `yaml:"path"`
+	// Policy is the name of the policy to select.
+	Policy string `yaml:"policy"`
+}
+
+// Load reads a policy configuration from a YAML (or JSON) file.
+func Load(name string) (*Config, error) {
+	file, err := os.Open(name) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("YAML decoder: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validate: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks that all policies are well-formed and that all rules select known policies.
+func (c *Config) Validate() error {
+	for name, pol := range c.Policies {
+		if pol == nil {
+			c.Policies[name] = &Policy{} //nolint:exhaustruct
+
+			continue
+		}
+
+		if err := pol.Validate(); err != nil {
+			return fmt.Errorf("policy %q: %w", name, err)
+		}
+	}
+
+	for idx, rule := range c.Rules {
+		if _, ok := c.Policies[rule.Policy]; !ok {
+			return fmt.Errorf("rule %d: %w: %q", idx, ErrUnknownPolicy, rule.Policy)
+		}
+	}
+
+	if _, ok := c.Policies[c.DefaultPolicy]; c.DefaultPolicy != "" && !ok {
+		return fmt.Errorf("default policy: %w: %q", ErrUnknownPolicy, c.DefaultPolicy)
+	}
+
+	return nil
+}
+
+// Lookup returns the policy with the given name.
+func (c *Config) Lookup(name string) (*Policy, error) {
+	if c != nil {
+		if pol, ok := c.Policies[name]; ok {
+			return pol, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPolicy, name)
+}
+
+// Match returns the policy selected by the first rule matching a request method, host and URI,
+// or the default policy if no rule matches. If no rule matches and there is no default policy,
+// [ErrNoMatchingRule] is returned when rules are configured, otherwise no policy is returned.
+func (c *Config) Match(method, host, uri string) (*Policy, error) {
+	if c == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	reqPath, err := cleanPath(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range c.Rules {
+		if rule.matches(method, host, reqPath) {
+			return c.Policies[rule.Policy], nil
+		}
+	}
+
+	switch {
+	case c.DefaultPolicy != "":
+		return c.Policies[c.DefaultPolicy], nil
+	case len(c.Rules) > 0:
+		return nil, fmt.Errorf("%w: %s %s%s", ErrNoMatchingRule, method, host, reqPath)
+	default:
+		return nil, nil //nolint:nilnil
+	}
+}
+
+// cleanPath returns the decoded and cleaned path of a request URI, without the query and
+// fragment parts. A trailing slash is kept, so that path prefixes ending in a slash still match.
+func cleanPath(uri string) (string, error) {
+	rawPath, _, _ := strings.Cut(uri, "?")
+	rawPath, _, _ = strings.Cut(rawPath, "#")
+
+	decoded, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidPath, err)
+	}
+
+	cleaned := path.Clean("/" + decoded)
+	if strings.HasSuffix(decoded, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned, nil
+}
+
+func (r *Rule) matches(method, host, reqPath string) bool {
+	if len(r.Methods) > 0 && !slices.ContainsFunc(r.Methods, func(val string) bool {
+		return strings.EqualFold(val, method)
+	}) {
+		return false
+	}
+
+	switch {
+	case r.Host == "":
+	case strings.HasPrefix(r.Host, "*."):
+		if !strings.HasSuffix(strings.ToLower(host), strings.ToLower(r.Host[1:])) {
+			return false
+		}
+	default:
+		if !strings.EqualFold(host, r.Host) {
+			return false
+		}
+	}
+
+	reqPath = strings.ToLower(reqPath)
+
+	if r.Path != "" {
+		pattern := strings.ToLower(r.Path)
+		if !matchWildcard(pattern, reqPath) && reqPath != strings.TrimSuffix(pattern, "/*") {
+			return false
+		}
+	}
+
+	return strings.HasPrefix(reqPath, strings.ToLower(r.PathPrefix))
+}
+
+// matchWildcard returns whether a value matches a pattern, where "*" matches any sequence of
+// characters.
+func matchWildcard(pattern, val string) bool {
+	prefix, rest, found := strings.Cut(pattern, "*")
+	if !found {
+		return pattern == val
+	}
+
+	if !strings.HasPrefix(val, prefix) {
+		return false
+	}
+
+	val = val[len(prefix):]
+	parts := strings.Split(rest, "*")
+
+	for _, part := range parts[:len(parts)-1] {
+		idx := strings.Index(val, part)
+		if idx < 0 {
+			return false
+		}
+
+		val = val[idx+len(part):]
+	}
+
+	return strings.HasSuffix(val, parts[len(parts)-1])
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConfigMatch(t *testing.T) {
+	t.Parallel()
+
+	orders := &Policy{Scopes: []string{"orders:read"}} //nolint:exhaustruct
+	api := &Policy{Scopes: []string{"api"}}            //nolint:exhaustruct
+	fallback := &Policy{Scopes: []string{"default"}}   //nolint:exhaustruct
+
+	rules := []*Rule{
+		{Methods: []string{"GET"}, Path: "/orders/*", Policy: "orders"}, //nolint:exhaustruct
+		{PathPrefix: "/api/", Policy: "api"},                            //nolint:exhaustruct
+	}
+	policies := map[string]*Policy{"orders": orders, "api": api, "default": fallback}
+
+	cfg := &Config{Policies: policies, Rules: rules}                            //nolint:exhaustruct
+	dcfg := &Config{Policies: policies, Rules: rules, DefaultPolicy: "default"} //nolint:exhaustruct
+	ncfg := &Config{Policies: policies}                                         //nolint:exhaustruct
+
+	tests := []struct {
+		name    string
+		cfg     *Config
+		uri     string
+		want    *Policy
+		wantErr error
+	}{
+		{"exact", cfg, "/orders/1", orders, nil},
+		{"query", cfg, "/orders/1?x=/other", orders, nil},
+		{"encoded", cfg, "/%6Frders/1", orders, nil},
+		{"case variant", cfg, "/Orders/1", orders, nil},
+		{"double slash", cfg, "//orders/1", orders, nil},
+		{"dot segments", cfg, "/other/../orders/1", orders, nil},
+		{"bare directory", cfg, "/orders", orders, nil},
+		{"prefix", cfg, "/api/items", api, nil},
+		{"prefix trailing slash", cfg, "/api/", api, nil},
+		{"encoded prefix", cfg, "/%41PI/items", api, nil},
+		{"invalid escape", cfg, "/orders/%zz", nil, ErrInvalidPath},
+		{"unmatched", cfg, "/other", nil, ErrNoMatchingRule},
+		{"unmatched default", dcfg, "/other", fallback, nil},
+		{"no rules", ncfg, "/other", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.cfg.Match("GET", "api.example.com:443", tt.uri)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("got policy %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidateDefaultPolicy(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{DefaultPolicy: "missing"} //nolint:exhaustruct
+	if err := cfg.Validate(); !errors.Is(err, ErrUnknownPolicy) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownPolicy)
+	}
+}
@@ -0,0 +1,5 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+// Package policy provides authorization policies for validated tokens.
+package policy
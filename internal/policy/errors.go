@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import "errors"
+
+// Errors used by the policy package.
+var (
+	// ErrInvalidClientID is returned when a token was issued to a client ID not allowed by a policy.
+	ErrInvalidClientID = errors.New("invalid client ID")
+	// ErrInvalidAudience is returned when a token was issued for an audience not allowed by a policy.
+	ErrInvalidAudience = errors.New("invalid audience")
+	// ErrInsufficientScope is returned when a token is missing scopes required by a policy.
+	ErrInsufficientScope = errors.New("insufficient scope")
+	// ErrClaimMismatch is returned when a token claim does not match a policy claim matcher.
+	ErrClaimMismatch = errors.New("claim mismatch")
+
+	// ErrUnsupportedScopeMode is returned when a policy uses an unsupported scope mode.
+	ErrUnsupportedScopeMode = errors.New("unsupported scope mode")
+	// ErrUnknownPolicy is returned when a policy name is not found.
+	ErrUnknownPolicy = errors.New("unknown policy")
+	// ErrNoMatchingRule is returned when a request does not match any policy selection rule.
+	ErrNoMatchingRule = errors.New("no matching rule")
+	// ErrInvalidPath is returned when a request path cannot be decoded.
+	ErrInvalidPath = errors.New("invalid path")
+)
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+)
+
+// Scope matching modes.
+const (
+	// ScopeModeAll requires a token to have all of the required scopes.
+	ScopeModeAll = "all"
+	// ScopeModeAny requires a token to have at least one of the required scopes.
+	ScopeModeAny = "any"
+)
+
+// Policy is an authorization policy for validated tokens.
+// Empty policy fields do not impose any requirements.
+type Policy struct {
+	// ClientIDs are the allowed client IDs that a token can be issued to.
+	ClientIDs []string `yaml:"client_ids"`
+	// Scopes are the required token scopes.
+	Scopes []string `yaml:"scopes"`
+	// ScopeMode is the matching mode for the required scopes (defaults to [ScopeModeAll]).
+	ScopeMode string `yaml:"scope_mode"`
+	// Audiences are the allowed audiences that a token can be issued for.
+	Audiences []string `yaml:"audiences"`
+	// Claims are claim matchers, mapping claim paths to allowed claim values.
+	// Claim paths can select members of nested objects using dots, e.g. "realm.roles".
+	Claims map[string][]string `yaml:"claims"`
+	// TokenSources are additional sources of tokens for requests without an Authorization header.
+	TokenSources TokenSources `yaml:"token_sources"`
+	// Issuer is the name of the issuer for validating tokens, when multiple issuers are configured.
+	Issuer string `yaml:"issuer"`
+}
+
+// TokenSources are additional sources of tokens for clients that cannot set an Authorization
+// header, e.g. WebSocket or Server-Sent Events clients in browsers.
+// Empty fields disable the corresponding token source.
+type TokenSources struct {
+	// Cookie is the name of a request cookie containing a token.
+	Cookie string `yaml:"cookie"`
+	// Header is the name of a custom request header containing a token.
+	Header string `yaml:"header"`
+	// Query enables the "access_token" query parameter of the forwarded request URI.
+	Query bool `yaml:"query"`
+}
+
+// Validate checks that the policy is well-formed.
+func (p *Policy) Validate() error {
+	switch p.ScopeMode {
+	case "", ScopeModeAll, ScopeModeAny:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedScopeMode, p.ScopeMode)
+	}
+}
+
+// Authorize checks that a validated token, described by its introspection response,
+// satisfies the policy.
+func (p *Policy) Authorize(ires *client.IntrospectionResponse) error {
+	if !matchAny(p.ClientIDs, func(val string) bool { return val == ires.ClientID }) {
+		return ErrInvalidClientID
+	}
+
+	if !matchAny(p.Audiences, ires.Audience.Contains) {
+		return ErrInvalidAudience
+	}
+
+	if !p.hasScopes(strings.Fields(ires.Scope)) {
+		return ErrInsufficientScope
+	}
+
+	for path, vals := range p.Claims {
+		claim, _ := ires.Claim(path)
+		cvals := claimValues(claim)
+
+		if !slices.ContainsFunc(vals, func(val string) bool {
+			return slices.Contains(cvals, val)
+		}) {
+			return fmt.Errorf("%w: %q", ErrClaimMismatch, path)
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) hasScopes(granted []string) bool {
+	if len(p.Scopes) == 0 {
+		return true
+	}
+
+	if p.ScopeMode == ScopeModeAny {
+		return slices.ContainsFunc(p.Scopes, func(val string) bool {
+			return slices.Contains(granted, val)
+		})
+	}
+
+	for _, val := range p.Scopes {
+		if !slices.Contains(granted, val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchAny(allowed []string, match func(val string) bool) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, val := range allowed {
+		if val != "" && match(val) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func claimValues(claim any) []string {
+	switch val := claim.(type) {
+	case string:
+		return []string{val}
+	case json.Number:
+		return []string{val.String()}
+	case bool:
+		return []string{strconv.FormatBool(val)}
+	case []any:
+		var vals []string
+		for _, elem := range val {
+			vals = append(vals, claimValues(elem)...)
+		}
+
+		return vals
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+)
+
+func TestPolicyAuthorize(t *testing.T) {
+	t.Parallel()
+
+	const response = `{
+		"active": true,
+		"client_id": "web",
+		"scope": "orders:read orders:write",
+		"realm": {"roles": ["admin", "user"], "level": 3, "staff": true}
+	}`
+
+	var ires client.IntrospectionResponse
+	if err := json.Unmarshal([]byte(response), &ires); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		wantErr error
+	}{
+		{"empty", &Policy{}, nil}, //nolint:exhaustruct
+		{
+			"allowed client ID",
+			&Policy{ClientIDs: []string{"mobile", "web"}}, //nolint:exhaustruct
+			nil,
+		},
+		{
+			"disallowed client ID",
+			&Policy{ClientIDs: []string{"mobile"}}, //nolint:exhaustruct
+			ErrInvalidClientID,
+		},
+		{
+			"all scopes",
+			&Policy{Scopes: []string{"orders:read", "orders:write"}}, //nolint:exhaustruct
+			nil,
+		},
+		{
+			"missing scope",
+			&Policy{Scopes: []string{"orders:read", "orders:delete"}}, //nolint:exhaustruct
+			ErrInsufficientScope,
+		},
+		{
+			"any scope",
+			&Policy{ //nolint:exhaustruct
+				Scopes:    []string{"orders:delete", "orders:write"},
+				ScopeMode: ScopeModeAny,
+			},
+			nil,
+		},
+		{
+			"no scope of any",
+			&Policy{ //nolint:exhaustruct
+				Scopes:    []string{"orders:delete", "admin"},
+				ScopeMode: ScopeModeAny,
+			},
+			ErrInsufficientScope,
+		},
+		{
+			"nested array claim",
+			&Policy{Claims: map[string][]string{"realm.roles": {"admin"}}}, //nolint:exhaustruct
+			nil,
+		},
+		{
+			"nested number and boolean claims",
+			&Policy{ //nolint:exhaustruct
+				Claims: map[string][]string{"realm.level": {"3"}, "realm.staff": {"true"}},
+			},
+			nil,
+		},
+		{
+			"nested claim mismatch",
+			&Policy{Claims: map[string][]string{"realm.roles": {"owner"}}}, //nolint:exhaustruct
+			ErrClaimMismatch,
+		},
+		{
+			"missing nested claim",
+			&Policy{Claims: map[string][]string{"realm.groups": {"admin"}}}, //nolint:exhaustruct
+			ErrClaimMismatch,
+		},
+		{
+			"object claim",
+			&Policy{Claims: map[string][]string{"realm": {"admin"}}}, //nolint:exhaustruct
+			ErrClaimMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.policy.Authorize(&ires); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyAuthorizeAudience(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		response  string
+		audiences []string
+		wantErr   error
+	}{
+		{"no audiences", `{"active": true, "aud": "other"}`, nil, nil},
+		{"string", `{"active": true, "aud": "api"}`, []string{"api"}, nil},
+		{"string mismatch", `{"active": true, "aud": "web"}`, []string{"api"}, ErrInvalidAudience},
+		{"array", `{"active": true, "aud": ["other", "api"]}`, []string{"api"}, nil},
+		{
+			"array mismatch",
+			`{"active": true, "aud": ["other", "web"]}`,
+			[]string{"api"},
+			ErrInvalidAudience,
+		},
+		{"any allowed", `{"active": true, "aud": ["web"]}`, []string{"api", "web"}, nil},
+		{"missing", `{"active": true}`, []string{"api"}, ErrInvalidAudience},
+		{"empty allowed", `{"active": true, "aud": ""}`, []string{""}, ErrInvalidAudience},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var ires client.IntrospectionResponse
+			if err := json.Unmarshal([]byte(tt.response), &ires); err != nil {
+				t.Fatal(err)
+			}
+
+			pol := &Policy{Audiences: tt.audiences} //nolint:exhaustruct
+			if err := pol.Authorize(&ires); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+)
+
+// verifyCertificateBinding verifies that a certificate-bound token (RFC 8705) is used with the
+// client certificate it was issued for, as forwarded by the proxy. Tokens that are not
+// certificate-bound are not verified.
+func verifyCertificateBinding(r *http.Request, ires *client.IntrospectionResponse) error {
+	thumbprint := ires.Confirmation(client.ConfirmationX5TS256)
+	if thumbprint == "" {
+		return nil
+	}
+
+	der, err := forwardedClientCert(r)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(der)
+	if subtle.ConstantTimeCompare(
+		[]byte(base64.RawURLEncoding.EncodeToString(sum[:])),
+		[]byte(thumbprint),
+	) != 1 {
+		return ErrCertificateMismatch
+	}
+
+	return nil
+}
+
+// forwardedClientCert returns the DER encoding of the client certificate forwarded by Traefik
+// in the X-Forwarded-Tls-Client-Cert header, which contains the URL-escaped base64 encoding of
+// the certificate chain (comma-separated), with or without the PEM delimiters.
+func forwardedClientCert(r *http.Request) ([]byte, error) {
+	val := r.Header.Get(HeaderXForwardedTLSClientCert)
+	if val == "" {
+		return nil, ErrMissingClientCert
+	}
+
+	val, err := url.QueryUnescape(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: URL unescape: %w", ErrMissingClientCert, err)
+	}
+
+	cert, _, _ := strings.Cut(val, ",")
+
+	if block, _ := pem.Decode([]byte(cert)); block != nil {
+		return block.Bytes, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(cert)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base64 decode: %w", ErrMissingClientCert, err)
+	}
+
+	return der, nil
+}
+
+// verifyDPoPBinding verifies that a DPoP-bound token (RFC 9449) is used with the DPoP scheme and a
+// valid DPoP proof for the original request, signed with the key the token was bound to.
+// Tokens that are not DPoP-bound are only accepted with other schemes.
+func verifyDPoPBinding(
+	r *http.Request,
+	dpop *client.DPoPValidator,
+	creds *Credentials,
+	ires *client.IntrospectionResponse,
+) error {
+	jkt := ires.Confirmation(client.ConfirmationJKT)
+
+	switch {
+	case creds.Scheme != AuthSchemeDPoP && jkt == "":
+		return nil
+	case creds.Scheme != AuthSchemeDPoP:
+		return fmt.Errorf(
+			"%w: DPoP-bound token used with the %s scheme",
+			ErrKeyMismatch,
+			creds.Scheme,
+		)
+	case jkt == "":
+		return fmt.Errorf("%w: token is not DPoP-bound", ErrKeyMismatch)
+	case dpop == nil:
+		return fmt.Errorf("%w: DPoP proofs are not supported", ErrInvalidDPoPProof)
+	}
+
+	proofs := r.Header.Values(HeaderDPoP)
+	if len(proofs) != 1 {
+		return fmt.Errorf("%w: exactly one proof is required", ErrInvalidDPoPProof)
+	}
+
+	method := cmp.Or(r.Header.Get(HeaderXForwardedMethod), r.Method)
+
+	thumbprint, err := dpop.Validate(proofs[0], method, forwardedURL(r), creds.Token)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(thumbprint), []byte(jkt)) != 1 {
+		return ErrKeyMismatch
+	}
+
+	return nil
+}
+
+// dpopChallenge returns the authentication challenge for a failed DPoP binding verification.
+func dpopChallenge(realm string, err error) *Challenge {
+	chal := &Challenge{ //nolint:exhaustruct
+		Scheme:           AuthSchemeDPoP,
+		Realm:            realm,
+		Error:            BearerErrorInvalidToken,
+		ErrorDescription: err.Error(),
+	}
+
+	if errors.Is(err, ErrInvalidDPoPProof) {
+		chal.Error = DPoPErrorInvalidProof
+
+		algs := make([]string, 0, len(client.SignatureAlgorithms))
+		for _, alg := range client.SignatureAlgorithms {
+			algs = append(algs, string(alg))
+		}
+
+		chal.Algs = strings.Join(algs, " ")
+	}
+
+	return chal
+}
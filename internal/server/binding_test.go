@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+)
+
+// introspectionResponse returns an active introspection response with the given confirmation.
+func introspectionResponse(t *testing.T, cnf map[string]string) *client.IntrospectionResponse {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{"active": true, "cnf": cnf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ires client.IntrospectionResponse
+	if err := json.Unmarshal(data, &ires); err != nil {
+		t.Fatal(err)
+	}
+
+	return &ires
+}
+
+func TestVerifyCertificateBinding(t *testing.T) {
+	t.Parallel()
+
+	// Certificates are not parsed, so any bytes do, including bytes encoded with "+" and "/".
+	leaf := []byte("leaf certificate \xfb\xff\xfe")
+	intermediate := []byte("intermediate certificate")
+
+	thumbprint := func(der []byte) string {
+		sum := sha256.Sum256(der)
+
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: leaf} //nolint:exhaustruct
+	leafPEM := url.QueryEscape(string(pem.EncodeToMemory(block)))
+	leafB64 := url.QueryEscape(base64.StdEncoding.EncodeToString(leaf))
+	chain := url.QueryEscape(
+		base64.StdEncoding.EncodeToString(leaf) + "," +
+			base64.StdEncoding.EncodeToString(intermediate),
+	)
+
+	bound := introspectionResponse(t, map[string]string{
+		client.ConfirmationX5TS256: thumbprint(leaf),
+	})
+	other := introspectionResponse(t, map[string]string{
+		client.ConfirmationX5TS256: thumbprint(intermediate),
+	})
+	unbound := introspectionResponse(t, nil)
+
+	tests := []struct {
+		name    string
+		header  string
+		ires    *client.IntrospectionResponse
+		wantErr error
+	}{
+		{"PEM", leafPEM, bound, nil},
+		{"bare base64", leafB64, bound, nil},
+		{"chain", chain, bound, nil},
+		{"chain bound to intermediate", chain, other, ErrCertificateMismatch},
+		{"missing header", "", bound, ErrMissingClientCert},
+		{"bad URL escape", "%zz", bound, ErrMissingClientCert},
+		{"bad base64", "not*base64", bound, ErrMissingClientCert},
+		{"thumbprint mismatch", leafB64, other, ErrCertificateMismatch},
+		{"unbound without header", "", unbound, nil},
+		{"unbound with header", leafB64, unbound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderXForwardedTLSClientCert, tt.header)
+			}
+
+			err := verifyCertificateBinding(req, tt.ires)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPBinding(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub := jose.JSONWebKey{Key: &key.PublicKey} //nolint:exhaustruct
+
+	thumbprint, err := pub.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jkt := base64.RawURLEncoding.EncodeToString(thumbprint)
+	validator := client.NewDPoPValidator(time.Minute, time.Second, 100)
+
+	opts := &jose.SignerOptions{EmbedJWK: true} //nolint:exhaustruct
+	opts = opts.WithType(client.DPoPProofType)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ath := sha256.Sum256([]byte("token"))
+	proof := func(jti string) string {
+		token, err := jwt.Signed(signer).Claims(map[string]any{
+			"jti": jti,
+			"htm": http.MethodGet,
+			"htu": "https://api.example.com/orders",
+			"iat": jwt.NewNumericDate(time.Now()),
+			"ath": base64.RawURLEncoding.EncodeToString(ath[:]),
+		}).Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	bound := introspectionResponse(t, map[string]string{client.ConfirmationJKT: jkt})
+	otherKey := introspectionResponse(t, map[string]string{client.ConfirmationJKT: "other"})
+	unbound := introspectionResponse(t, nil)
+	twoProofs := []string{proof("e"), proof("e")}
+
+	tests := []struct {
+		name    string
+		scheme  string
+		proofs  []string
+		ires    *client.IntrospectionResponse
+		wantErr error
+	}{
+		{"bound", AuthSchemeDPoP, []string{proof("a")}, bound, nil},
+		{"unbound bearer", AuthSchemeBearer, nil, unbound, nil},
+		{"thumbprint mismatch", AuthSchemeDPoP, []string{proof("b")}, otherKey, ErrKeyMismatch},
+		{"bound with bearer", AuthSchemeBearer, []string{proof("c")}, bound, ErrKeyMismatch},
+		{"unbound with DPoP", AuthSchemeDPoP, []string{proof("d")}, unbound, ErrKeyMismatch},
+		{"no proof", AuthSchemeDPoP, nil, bound, ErrInvalidDPoPProof},
+		{"two proofs", AuthSchemeDPoP, twoProofs, bound, ErrInvalidDPoPProof},
+		{"replayed", AuthSchemeDPoP, []string{proof("a")}, bound, ErrInvalidDPoPProof},
+	}
+
+	for _, tt := range tests { //nolint:paralleltest
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			req.Header.Set(HeaderXForwardedProto, "https")
+			req.Header.Set(HeaderXForwardedHost, "api.example.com")
+			req.Header.Set(HeaderXForwardedURI, "/orders?page=2")
+
+			for _, p := range tt.proofs {
+				req.Header.Add(HeaderDPoP, p)
+			}
+
+			creds := &Credentials{Scheme: tt.scheme, Token: "token"} //nolint:exhaustruct
+
+			err := verifyDPoPBinding(req, validator, creds, tt.ires)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Bearer token error codes (RFC 6750).
+const (
+	// BearerErrorInvalidRequest is the error code for malformed requests.
+	BearerErrorInvalidRequest = "invalid_request"
+	// BearerErrorInvalidToken is the error code for expired, revoked, malformed or invalid tokens.
+	BearerErrorInvalidToken = "invalid_token"
+	// BearerErrorInsufficientScope is the error code for tokens without the required privileges.
+	BearerErrorInsufficientScope = "insufficient_scope"
+	// DPoPErrorInvalidProof is the error code for missing or invalid DPoP proofs (RFC 9449).
+	DPoPErrorInvalidProof = "invalid_dpop_proof"
+)
+
+// Challenge is an authentication challenge (RFC 7235) for the WWW-Authenticate response header,
+// with the parameters defined for the Bearer (RFC 6750) and DPoP (RFC 9449) authentication schemes.
+// Empty parameters are omitted.
+type Challenge struct {
+	Scheme           string
+	Realm            string
+	Error            string
+	ErrorDescription string
+	Scope            string
+	Algs             string
+}
+
+// String returns the challenge formatted for the WWW-Authenticate response header.
+func (c *Challenge) String() string {
+	params := make([]string, 0, 5) //nolint:mnd
+
+	for _, param := range [][2]string{
+		{"realm", c.Realm},
+		{"error", c.Error},
+		{"error_description", c.ErrorDescription},
+		{"scope", c.Scope},
+		{"algs", c.Algs},
+	} {
+		if param[1] != "" {
+			params = append(params, param[0]+"="+quoteString(param[1]))
+		}
+	}
+
+	if len(params) == 0 {
+		return c.Scheme
+	}
+
+	return c.Scheme + " " + strings.Join(params, ", ")
+}
+
+// ChallengeError replies to the request like [Error], with an authentication challenge set in
+// the WWW-Authenticate response header.
+func ChallengeError(
+	writer http.ResponseWriter,
+	request *http.Request,
+	chal *Challenge,
+	err error,
+	code int,
+) {
+	writer.Header().Set(HeaderWWWAuthenticate, chal.String())
+	Error(writer, request, err, code)
+}
+
+// quoteString returns a quoted string (RFC 9110, Section 5.6.4) with the characters allowed in
+// Bearer challenge parameters (RFC 6750, Section 3), replacing any other characters.
+func quoteString(val string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+
+	for _, c := range []byte(val) {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\'')
+		case c < 0x20 || c > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
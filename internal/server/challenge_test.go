@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"testing"
+)
+
+func TestChallengeString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		chal *Challenge
+		want string
+	}{
+		{
+			"scheme only",
+			&Challenge{Scheme: AuthSchemeBearer}, //nolint:exhaustruct
+			`Bearer`,
+		},
+		{
+			"realm",
+			&Challenge{Scheme: AuthSchemeBearer, Realm: "api"}, //nolint:exhaustruct
+			`Bearer realm="api"`,
+		},
+		{
+			"all parameters",
+			&Challenge{
+				Scheme:           AuthSchemeDPoP,
+				Realm:            "api",
+				Error:            BearerErrorInsufficientScope,
+				ErrorDescription: "insufficient scope",
+				Scope:            "orders:read orders:write",
+				Algs:             "ES256 RS256",
+			},
+			`DPoP realm="api", error="insufficient_scope", ` +
+				`error_description="insufficient scope", scope="orders:read orders:write", ` +
+				`algs="ES256 RS256"`,
+		},
+		{
+			"quotes and backslashes",
+			&Challenge{ //nolint:exhaustruct
+				Scheme:           AuthSchemeBearer,
+				Realm:            `my "api"`,
+				ErrorDescription: `unsupported scheme: "Basic\x"`,
+			},
+			`Bearer realm="my 'api'", error_description="unsupported scheme: 'Basic'x'"`,
+		},
+		{
+			"control and non-ASCII characters",
+			&Challenge{ //nolint:exhaustruct
+				Scheme:           AuthSchemeBearer,
+				ErrorDescription: "bad\ttoken\n",
+				Scope:            "café",
+			},
+			`Bearer error_description="bad?token?", scope="caf??"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.chal.String(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
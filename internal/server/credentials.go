@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Authentication schemes.
+const (
+	// AuthSchemeBearer is the OAuth 2.0 Bearer Token (RFC 6750) authentication scheme.
+	AuthSchemeBearer = "Bearer"
+	// AuthSchemeDPoP is the OAuth 2.0 Demonstrating Proof of Possession (RFC 9449)
+	// authentication scheme.
+	AuthSchemeDPoP = "DPoP"
+	// AuthSchemeBasic is the HTTP Basic (RFC 7617) authentication scheme.
+	AuthSchemeBasic = "Basic"
+)
+
+// Credentials are the authentication credentials of a request.
+type Credentials struct {
+	// Scheme is the authentication scheme of the credentials.
+	Scheme string
+	// Token is the token to validate. For the Basic scheme, the password is used as the token.
+	Token string
+	// Username is the username for the Basic scheme.
+	Username string
+}
+
+// ParseAuthorization parses the value of an Authorization header (RFC 7235) with the credentials
+// of one of the supported authentication schemes. Schemes are matched case-insensitively and the
+// credentials must be in the token68 form.
+func ParseAuthorization(value string) (*Credentials, error) {
+	value = strings.Trim(value, " \t")
+
+	scheme, cred := value, ""
+	if idx := strings.IndexAny(value, " \t"); idx >= 0 {
+		scheme, cred = value[:idx], strings.TrimLeft(value[idx:], " \t")
+	}
+
+	if !isToken(scheme) || !isToken68(cred) {
+		return nil, ErrUnsupportedAuthSyntax
+	}
+
+	switch {
+	case strings.EqualFold(scheme, AuthSchemeBearer):
+		return &Credentials{Scheme: AuthSchemeBearer, Token: cred}, nil //nolint:exhaustruct
+	case strings.EqualFold(scheme, AuthSchemeDPoP):
+		return &Credentials{Scheme: AuthSchemeDPoP, Token: cred}, nil //nolint:exhaustruct
+	case strings.EqualFold(scheme, AuthSchemeBasic):
+		return parseBasic(cred)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAuthScheme, scheme)
+	}
+}
+
+func parseBasic(cred string) (*Credentials, error) {
+	data, err := base64.StdEncoding.DecodeString(cred)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base64 decode: %w", ErrUnsupportedAuthSyntax, err)
+	}
+
+	username, password, ok := strings.Cut(string(data), ":")
+	if !ok || password == "" {
+		return nil, fmt.Errorf("%w: missing password", ErrUnsupportedAuthSyntax)
+	}
+
+	creds := &Credentials{
+		Scheme:   AuthSchemeBasic,
+		Token:    password,
+		Username: username,
+	}
+
+	return creds, nil
+}
+
+// isToken returns whether a string is a token as defined in RFC 9110, Section 5.6.2.
+func isToken(val string) bool {
+	if val == "" {
+		return false
+	}
+
+	for _, c := range []byte(val) {
+		if !isAlphaNum(c) && !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isToken68 returns whether a string is a token68 as defined in RFC 7235, Section 2.1.
+func isToken68(val string) bool {
+	trimmed := strings.TrimRight(val, "=")
+	if trimmed == "" {
+		return false
+	}
+
+	for _, c := range []byte(trimmed) {
+		if !isAlphaNum(c) && !strings.ContainsRune("-._~+/", rune(c)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isAlphaNum(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
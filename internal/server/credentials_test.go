@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAuthorization(t *testing.T) {
+	t.Parallel()
+
+	bearer := func(token string) *Credentials {
+		return &Credentials{Scheme: AuthSchemeBearer, Token: token} //nolint:exhaustruct
+	}
+
+	basic := func(username, password string) *Credentials {
+		return &Credentials{Scheme: AuthSchemeBasic, Token: password, Username: username}
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    *Credentials
+		wantErr error
+	}{
+		{"bearer", "Bearer a.b-c_d~e+f/g", bearer("a.b-c_d~e+f/g"), nil},
+		{"lowercase scheme", "bearer abc", bearer("abc"), nil},
+		{"uppercase scheme", "BEARER abc", bearer("abc"), nil},
+		{"multiple spaces", "Bearer   abc", bearer("abc"), nil},
+		{"tab", "Bearer\tabc", bearer("abc"), nil},
+		{"surrounding whitespace", " \tBearer abc\t ", bearer("abc"), nil},
+		{"padding", "Bearer abc==", bearer("abc=="), nil},
+		{
+			"dpop",
+			"dpop abc",
+			&Credentials{Scheme: AuthSchemeDPoP, Token: "abc"}, //nolint:exhaustruct
+			nil,
+		},
+		{"basic", "Basic YWxpY2U6c2VjcmV0", basic("alice", "secret"), nil},
+		{"basic colon in password", "basic YWxpY2U6cGE6c3M=", basic("alice", "pa:ss"), nil},
+		{"basic empty username", "Basic OnNlY3JldA==", basic("", "secret"), nil},
+		{"empty", "", nil, ErrUnsupportedAuthSyntax},
+		{"whitespace only", " \t ", nil, ErrUnsupportedAuthSyntax},
+		{"scheme only", "Bearer", nil, ErrUnsupportedAuthSyntax},
+		{"padding only", "Bearer ==", nil, ErrUnsupportedAuthSyntax},
+		{"padding in the middle", "Bearer ab=c", nil, ErrUnsupportedAuthSyntax},
+		{"invalid character", "Bearer abc,def", nil, ErrUnsupportedAuthSyntax},
+		{"space in token", "Bearer abc def", nil, ErrUnsupportedAuthSyntax},
+		{"auth params", `Bearer realm="api"`, nil, ErrUnsupportedAuthSyntax},
+		{"invalid scheme", "Bea(rer abc", nil, ErrUnsupportedAuthSyntax},
+		{"basic missing colon", "Basic YWxpY2U=", nil, ErrUnsupportedAuthSyntax},
+		{"basic empty password", "Basic YWxpY2U6", nil, ErrUnsupportedAuthSyntax},
+		{"basic bad base64", "Basic YWxpY2U", nil, ErrUnsupportedAuthSyntax},
+		{"unsupported scheme", "Digest abc", nil, ErrUnsupportedAuthScheme},
+		{"unsupported scheme with token", "Negotiate YWxpY2U=", nil, ErrUnsupportedAuthScheme},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseAuthorization(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("got credentials %+v, want none", got)
+				}
+
+				return
+			}
+
+			if got == nil || *got != *tt.want {
+				t.Fatalf("got credentials %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,8 +7,27 @@ import "errors"
 
 // Errors used by the server package.
 var (
-	// ErrMissingRequestHeader is returned when a client request is missing a header.
-	ErrMissingRequestHeader = errors.New("missing request header")
+	// ErrMissingToken is returned when a client request is missing a token.
+	ErrMissingToken = errors.New("missing token")
 	// ErrUnsupportedAuthSyntax is returned when a client request uses an unsupported authorization syntax.
 	ErrUnsupportedAuthSyntax = errors.New("unsupported authorization syntax")
+	// ErrUnsupportedAuthScheme is returned when a client request uses an unsupported authentication scheme.
+	ErrUnsupportedAuthScheme = errors.New("unsupported authentication scheme")
+	// ErrStateMismatch is returned when a login callback request does not match the login state.
+	ErrStateMismatch = errors.New("state mismatch")
+	// ErrAuthorizationFailed is returned when an authorization server rejects a login.
+	ErrAuthorizationFailed = errors.New("authorization failed")
+	// ErrInactiveToken is returned when a client request uses an inactive token.
+	ErrInactiveToken = errors.New("inactive token")
+	// ErrMissingClientCert is returned when a client request is missing a forwarded client certificate.
+	ErrMissingClientCert = errors.New("missing client certificate")
+	// ErrCertificateMismatch is returned when a certificate-bound token is used with another certificate.
+	ErrCertificateMismatch = errors.New("certificate mismatch")
+	// ErrInvalidDPoPProof is returned when a client request has a missing or invalid DPoP proof.
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	// ErrKeyMismatch is returned when a DPoP-bound token is used with another proof key or without
+	// the DPoP scheme.
+	ErrKeyMismatch = errors.New("key mismatch")
+	// ErrCookieTooLarge is returned when a cookie exceeds the size supported by browsers.
+	ErrCookieTooLarge = errors.New("cookie too large")
 )
@@ -4,9 +4,18 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/metrics"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/policy"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/session"
 )
 
 const (
@@ -14,35 +23,221 @@ const (
 	QueryParamClientID = "client_id"
 	// QueryParamTokenTypeHint is the request query parameter used for providing a token type hint.
 	QueryParamTokenTypeHint = "token_type_hint"
+	// QueryParamScope is the request query parameter used for providing required scopes.
+	QueryParamScope = "scope"
+	// QueryParamScopeMode is the request query parameter used for providing the scope matching mode.
+	QueryParamScopeMode = "scope_mode"
+	// QueryParamAudience is the request query parameter used for providing allowed audiences.
+	QueryParamAudience = "audience"
+	// QueryParamIssuer is the request query parameter used for providing an issuer name.
+	QueryParamIssuer = "issuer"
 )
 
+const (
+	// PathValuePolicy is the request path value used for providing a policy name.
+	PathValuePolicy = "policy"
+)
+
+// Claim header formats for rendering array and object claim values.
+const (
+	// ClaimHeaderFormatCSV renders arrays as comma-separated values and objects as JSON.
+	ClaimHeaderFormatCSV = "csv"
+	// ClaimHeaderFormatSpace renders arrays as space-separated values and objects as JSON.
+	ClaimHeaderFormatSpace = "space"
+	// ClaimHeaderFormatJSON renders arrays and objects as JSON.
+	ClaimHeaderFormatJSON = "json"
+)
+
+// AuthConfig is the configuration for the auth handler.
+type AuthConfig struct {
+	// Realm is the protection space in authentication challenges, if any.
+	Realm string
+	// Issuers routes tokens to the introspectors used for validating them.
+	Issuers *client.IssuerRouter
+	// Policies are the named authorization policies and the rules for selecting them.
+	Policies *policy.Config
+	// Audiences are the allowed token audiences when none are required by the auth request.
+	Audiences []string
+	// ClaimHeaders maps token claim paths to response header names for identity propagation.
+	// Claim paths can select members of nested objects using dots, e.g. "realm.roles".
+	ClaimHeaders map[string]string
+	// ClaimHeaderFormat is the format for rendering array and object claim values in headers.
+	ClaimHeaderFormat string
+	// Login is the configuration for browser logins, if enabled.
+	Login *LoginConfig
+	// BackChannelLogout is the configuration for back-channel logouts, if enabled.
+	BackChannelLogout *BackChannelLogoutConfig
+	// DPoP is the validator for DPoP proofs of DPoP-bound tokens, if supported.
+	DPoP *client.DPoPValidator
+}
+
 // AuthHandler is an [http.Handler] for authentication requests.
-func AuthHandler(isrv *client.IntrospectionService) http.Handler {
+//
+// Tokens are taken from the request credentials if extracted from the Authorization header, or
+// otherwise from the additional token sources enabled by the selected policies. If browser logins
+// are enabled, requests without a token are authenticated using browser sessions.
+//
+// Tokens are authorized using the policy named in the request path or, if not provided,
+// the policy selected by the first rule matching the forwarded method, host and URI, if any.
+// In addition, tokens are authorized using the policy given in the request query parameters.
+//
+// Tokens are validated by the issuer named in the selected policies, if any, or otherwise by the
+// issuer routed from the forwarded host or the token itself. Certificate-bound tokens are only
+// accepted with the client certificate forwarded by the proxy, and DPoP-bound tokens are only
+// accepted with the DPoP scheme and a valid proof for the forwarded method and URI.
+func AuthHandler(cfg *AuthConfig) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		ctx := request.Context()
 
-		token := TokenFromContext(ctx)
+		policies, err := requestPolicies(request, cfg)
+		if err != nil {
+			code := http.StatusBadRequest
+
+			switch {
+			case errors.Is(err, policy.ErrUnknownPolicy):
+				code = http.StatusNotFound
+			case errors.Is(err, policy.ErrNoMatchingRule):
+				chal := &Challenge{ //nolint:exhaustruct
+					Scheme:           AuthSchemeBearer,
+					Realm:            cfg.Realm,
+					ErrorDescription: err.Error(),
+				}
+				ChallengeError(writer, request, chal, err, http.StatusForbidden)
+
+				return
+			}
+
+			Error(writer, request, err, code)
+
+			return
+		}
+
+		creds := CredentialsFromContext(ctx)
+
+		if creds == nil {
+			if token, source := policyToken(request, policies); token != "" {
+				creds = &Credentials{Scheme: AuthSchemeBearer, Token: token} //nolint:exhaustruct
+
+				metrics.AuthTokenSourcesTotal.WithLabelValues(source).Inc()
+			}
+		}
+
+		var sess *session.Session
+
+		if creds == nil && cfg.Login != nil && cfg.Login.canLogin(request) {
+			var ok bool
+			if sess, ok = cfg.Login.authenticate(writer, request); !ok {
+				return
+			}
+
+			creds = &Credentials{ //nolint:exhaustruct
+				Scheme: AuthSchemeBearer,
+				Token:  sess.AccessToken,
+			}
+
+			metrics.AuthTokenSourcesTotal.WithLabelValues(TokenSourceSession).Inc()
+		}
+
+		if creds == nil {
+			chal := &Challenge{Scheme: AuthSchemeBearer, Realm: cfg.Realm} //nolint:exhaustruct
+			ChallengeError(writer, request, chal, ErrMissingToken, http.StatusUnauthorized)
+
+			return
+		}
+
 		tth := request.URL.Query().Get(QueryParamTokenTypeHint)
 
-		ires, err := isrv.Introspect(ctx, token, tth)
+		isrv, err := cfg.Issuers.Route(
+			requestIssuer(policies),
+			request.Header.Get(HeaderXForwardedHost),
+			creds.Token,
+		)
 		if err != nil {
-			Error(writer, request, "introspect: "+err.Error(), http.StatusBadGateway)
+			if errors.Is(err, client.ErrUnknownIssuer) {
+				Error(writer, request, err, http.StatusNotFound)
+
+				return
+			}
+
+			chal := &Challenge{ //nolint:exhaustruct
+				Scheme:           AuthSchemeBearer,
+				Realm:            cfg.Realm,
+				Error:            BearerErrorInvalidToken,
+				ErrorDescription: err.Error(),
+			}
+			ChallengeError(writer, request, chal, err, http.StatusUnauthorized)
+
+			return
+		}
+
+		ires, err := isrv.Introspect(ctx, creds.Token, tth)
+		if err != nil {
+			code := http.StatusBadGateway
+			if errors.Is(err, client.ErrCircuitOpen) {
+				code = http.StatusServiceUnavailable
+			}
+
+			Error(writer, request, fmt.Errorf("introspect: %w", err), code)
 
 			return
 		}
 
 		if !ires.Active {
-			Error(writer, request, "inactive token", http.StatusUnauthorized)
+			if sess != nil {
+				cfg.Login.login(writer, request)
+
+				return
+			}
+
+			chal := &Challenge{ //nolint:exhaustruct
+				Scheme:           AuthSchemeBearer,
+				Realm:            cfg.Realm,
+				Error:            BearerErrorInvalidToken,
+				ErrorDescription: ErrInactiveToken.Error(),
+			}
+			ChallengeError(writer, request, chal, ErrInactiveToken, http.StatusUnauthorized)
 
 			return
 		}
 
-		if !isValidClientID(request, ires.ClientID) {
-			Error(writer, request, "invalid client ID", http.StatusForbidden)
+		if err := verifyCertificateBinding(request, ires); err != nil {
+			chal := &Challenge{ //nolint:exhaustruct
+				Scheme:           AuthSchemeBearer,
+				Realm:            cfg.Realm,
+				Error:            BearerErrorInvalidToken,
+				ErrorDescription: err.Error(),
+			}
+			ChallengeError(writer, request, chal, err, http.StatusUnauthorized)
 
 			return
 		}
 
+		if err := verifyDPoPBinding(request, cfg.DPoP, creds, ires); err != nil {
+			chal := dpopChallenge(cfg.Realm, err)
+			ChallengeError(writer, request, chal, err, http.StatusUnauthorized)
+
+			return
+		}
+
+		for _, pol := range policies {
+			if err := pol.Authorize(ires); err != nil {
+				chal := &Challenge{ //nolint:exhaustruct
+					Scheme:           AuthSchemeBearer,
+					Realm:            cfg.Realm,
+					ErrorDescription: err.Error(),
+				}
+
+				if errors.Is(err, policy.ErrInsufficientScope) {
+					chal.Error = BearerErrorInsufficientScope
+					chal.Scope = strings.Join(pol.Scopes, " ")
+				}
+
+				ChallengeError(writer, request, chal, err, http.StatusForbidden)
+
+				return
+			}
+		}
+
 		if ires.ClientID != "" {
 			writer.Header().Set(HeaderXForwardedClientID, ires.ClientID)
 		}
@@ -54,20 +249,135 @@ func AuthHandler(isrv *client.IntrospectionService) http.Handler {
 		if ires.Subject != "" {
 			writer.Header().Set(HeaderXForwardedSubject, ires.Subject)
 		}
+
+		for path, name := range cfg.ClaimHeaders {
+			claim, _ := ires.Claim(path)
+			if val := formatClaim(claim, cfg.ClaimHeaderFormat); val != "" {
+				writer.Header().Set(name, val)
+			}
+		}
 	})
 }
 
-func isValidClientID(r *http.Request, cid string) bool {
-	cids := r.URL.Query()[QueryParamClientID]
-	if len(cids) == 0 {
-		return true
+func requestPolicies(r *http.Request, cfg *AuthConfig) ([]*policy.Policy, error) {
+	var policies []*policy.Policy
+
+	if name := r.PathValue(PathValuePolicy); name != "" {
+		pol, err := cfg.Policies.Lookup(name)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		policies = append(policies, pol)
+	} else {
+		pol, err := cfg.Policies.Match(
+			r.Header.Get(HeaderXForwardedMethod),
+			r.Header.Get(HeaderXForwardedHost),
+			r.Header.Get(HeaderXForwardedURI),
+		)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		if pol != nil {
+			policies = append(policies, pol)
+		}
 	}
 
-	for _, val := range cids {
-		if val != "" && cid == val {
+	qpol, err := queryPolicy(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(qpol.Audiences) == 0 && !hasAudiences(policies) {
+		qpol.Audiences = cfg.Audiences
+	}
+
+	return append(policies, qpol), nil
+}
+
+func queryPolicy(query url.Values) (*policy.Policy, error) {
+	var scopes []string
+	for _, val := range query[QueryParamScope] {
+		scopes = append(scopes, strings.Fields(val)...)
+	}
+
+	pol := &policy.Policy{ //nolint:exhaustruct
+		ClientIDs: query[QueryParamClientID],
+		Scopes:    scopes,
+		ScopeMode: query.Get(QueryParamScopeMode),
+		Audiences: query[QueryParamAudience],
+		Issuer:    query.Get(QueryParamIssuer),
+	}
+
+	if err := pol.Validate(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return pol, nil
+}
+
+func requestIssuer(policies []*policy.Policy) string {
+	for _, pol := range policies {
+		if pol.Issuer != "" {
+			return pol.Issuer
+		}
+	}
+
+	return ""
+}
+
+func hasAudiences(policies []*policy.Policy) bool {
+	for _, pol := range policies {
+		if len(pol.Audiences) > 0 {
 			return true
 		}
 	}
 
 	return false
 }
+
+func formatClaim(claim any, format string) string {
+	switch val := claim.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	case []any:
+		if format == ClaimHeaderFormatJSON {
+			return formatClaimJSON(val)
+		}
+
+		sep := ","
+		if format == ClaimHeaderFormatSpace {
+			sep = " "
+		}
+
+		vals := make([]string, 0, len(val))
+
+		for _, elem := range val {
+			if _, ok := elem.([]any); ok {
+				vals = append(vals, formatClaimJSON(elem))
+			} else {
+				vals = append(vals, formatClaim(elem, format))
+			}
+		}
+
+		return strings.Join(vals, sep)
+	default:
+		return formatClaimJSON(val)
+	}
+}
+
+func formatClaimJSON(claim any) string {
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
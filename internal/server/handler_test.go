@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/policy"
+)
+
+// errorIntrospector is an introspector failing with an error.
+type errorIntrospector struct {
+	err error
+}
+
+func (e *errorIntrospector) Introspect(
+	_ context.Context,
+	_, _ string,
+) (*client.IntrospectionResponse, error) {
+	return nil, e.err
+}
+
+func TestAuthHandlerPolicyErrors(t *testing.T) {
+	t.Parallel()
+
+	rule := &policy.Rule{PathPrefix: "/orders/", Policy: "orders"} //nolint:exhaustruct
+	cfg := &AuthConfig{                                            //nolint:exhaustruct
+		Realm: "api",
+		Policies: &policy.Config{ //nolint:exhaustruct
+			Policies: map[string]*policy.Policy{"orders": {}}, //nolint:exhaustruct
+			Rules:    []*policy.Rule{rule},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		policy        string
+		uri           string
+		wantCode      int
+		wantChallenge string
+	}{
+		{
+			"no matching rule",
+			"",
+			"/other",
+			http.StatusForbidden,
+			`Bearer realm="api", error_description="no matching rule: GET api.example.com/other"`,
+		},
+		{"unknown policy", "missing", "/orders/1", http.StatusNotFound, ""},
+		{"invalid path", "", "/%zz", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			req.Header.Set(HeaderXForwardedMethod, http.MethodGet)
+			req.Header.Set(HeaderXForwardedHost, "api.example.com")
+			req.Header.Set(HeaderXForwardedURI, tt.uri)
+			req.SetPathValue(PathValuePolicy, tt.policy)
+
+			rec := httptest.NewRecorder()
+			AuthHandler(cfg).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if got := rec.Header().Get(HeaderWWWAuthenticate); got != tt.wantChallenge {
+				t.Fatalf("got challenge %q, want %q", got, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestAuthHandlerIntrospectionErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+	}{
+		{
+			"open circuit",
+			fmt.Errorf("breaker: %w", client.ErrCircuitOpen),
+			http.StatusServiceUnavailable,
+		},
+		{"upstream error", errors.New("connection refused"), http.StatusBadGateway}, //nolint:err113
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &AuthConfig{ //nolint:exhaustruct
+				Issuers: &client.IssuerRouter{ //nolint:exhaustruct
+					Default: &errorIntrospector{err: tt.err},
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			creds := &Credentials{Scheme: AuthSchemeBearer, Token: "token"} //nolint:exhaustruct
+			ctx := context.WithValue(req.Context(), ctxKeyCredentials, creds)
+
+			rec := httptest.NewRecorder()
+			AuthHandler(cfg).ServeHTTP(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestFormatClaim(t *testing.T) {
+	t.Parallel()
+
+	const response = `{
+		"active": true,
+		"name": "alice",
+		"level": 3,
+		"staff": true,
+		"roles": ["admin", "user"],
+		"mixed": ["a", 1, false, ["b", "c"], {"d": "e"}],
+		"realm": {"roles": ["admin"], "level": 3}
+	}`
+
+	var ires client.IntrospectionResponse
+	if err := json.Unmarshal([]byte(response), &ires); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		claim  string
+		format string
+		want   string
+	}{
+		{"name", ClaimHeaderFormatJSON, "alice"},
+		{"level", ClaimHeaderFormatJSON, "3"},
+		{"staff", ClaimHeaderFormatJSON, "true"},
+		{"missing", ClaimHeaderFormatCSV, ""},
+		{"roles", ClaimHeaderFormatCSV, "admin,user"},
+		{"roles", ClaimHeaderFormatSpace, "admin user"},
+		{"roles", ClaimHeaderFormatJSON, `["admin","user"]`},
+		{"mixed", ClaimHeaderFormatCSV, `a,1,false,["b","c"],{"d":"e"}`},
+		{"mixed", ClaimHeaderFormatSpace, `a 1 false ["b","c"] {"d":"e"}`},
+		{"mixed", ClaimHeaderFormatJSON, `["a",1,false,["b","c"],{"d":"e"}]`},
+		{"realm", ClaimHeaderFormatCSV, `{"level":3,"roles":["admin"]}`},
+		{"realm", ClaimHeaderFormatJSON, `{"level":3,"roles":["admin"]}`},
+		{"realm.roles", ClaimHeaderFormatCSV, "admin"},
+		{"realm.level", ClaimHeaderFormatCSV, "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.claim+" "+tt.format, func(t *testing.T) {
+			t.Parallel()
+
+			claim, _ := ires.Claim(tt.claim)
+			if got := formatClaim(claim, tt.format); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
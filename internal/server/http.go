@@ -5,6 +5,8 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -15,10 +17,34 @@ import (
 
 // HTTP headers used by the server package.
 const (
-	HeaderAuthorization      = "Authorization"
-	HeaderXForwardedClientID = "X-Forwarded-Client-Id"
-	HeaderXForwardedScope    = "X-Forwarded-Scope"
-	HeaderXForwardedSubject  = "X-Forwarded-Subject"
+	HeaderAccept                  = "Accept"
+	HeaderAuthorization           = "Authorization"
+	HeaderCacheControl            = "Cache-Control"
+	HeaderContentLength           = "Content-Length"
+	HeaderContentType             = "Content-Type"
+	HeaderDPoP                    = "DPoP"
+	HeaderWWWAuthenticate         = "WWW-Authenticate"
+	HeaderXContentTypeOptions     = "X-Content-Type-Options"
+	HeaderXForwardedClientID      = "X-Forwarded-Client-Id"
+	HeaderXForwardedHost          = "X-Forwarded-Host"
+	HeaderXForwardedMethod        = "X-Forwarded-Method"
+	HeaderXForwardedProto         = "X-Forwarded-Proto"
+	HeaderXForwardedScope         = "X-Forwarded-Scope"
+	HeaderXForwardedSubject       = "X-Forwarded-Subject"
+	HeaderXForwardedTLSClientCert = "X-Forwarded-Tls-Client-Cert"
+	HeaderXForwardedURI           = "X-Forwarded-Uri"
+)
+
+// Content types used by the server package.
+const (
+	ContentTypeTextPlain   = "text/plain; charset=utf-8"
+	ContentTypeJSON        = "application/json"
+	ContentTypeProblemJSON = "application/problem+json"
+)
+
+// Cache control directives used by the server package.
+const (
+	CacheControlNoStore = "no-store"
 )
 
 const (
@@ -44,17 +70,34 @@ func Run(ctx context.Context, addr string, handler http.Handler) error {
 	return nil
 }
 
-// Error replies to the request with the specified error message and HTTP code.
-// It also logs the request remote address, error and code as a warning.
-// For the case of [http.StatusUnauthorized] and [http.StatusForbidden] codes,
-// the logs are emitted at the debug level.
-func Error(writer http.ResponseWriter, request *http.Request, err string, code int) {
-	http.Error(writer, err, code)
+// Error replies to the request with the problem details of an error and HTTP code, either as
+// JSON (RFC 9457) or as plain text, depending on the Accept request header.
+// It also logs the request remote address, error, code and the correlation ID of the problem
+// details as a warning. For the case of [http.StatusUnauthorized] and [http.StatusForbidden]
+// codes, the logs are emitted at the debug level.
+func Error(writer http.ResponseWriter, request *http.Request, err error, code int) {
+	prob := NewProblem(err, code, rand.Text())
+
+	if acceptsProblemJSON(request.Header.Get(HeaderAccept)) {
+		writer.Header().Del(HeaderContentLength)
+		writer.Header().Set(HeaderContentType, ContentTypeProblemJSON)
+		writer.Header().Set(HeaderXContentTypeOptions, "nosniff")
+		writer.WriteHeader(code)
+		json.NewEncoder(writer).Encode(prob) //nolint:errcheck,errchkjson
+	} else {
+		http.Error(writer, prob.String(), code)
+	}
 
 	logFn := slog.Warn
 	if code == http.StatusUnauthorized || code == http.StatusForbidden {
 		logFn = slog.Debug
 	}
 
-	logFn("request error", "addr", request.RemoteAddr, "err", err, "code", code)
+	logFn(
+		"request error",
+		"addr", request.RemoteAddr,
+		"err", err,
+		"code", code,
+		"correlation_id", prob.CorrelationID,
+	)
 }
@@ -0,0 +1,465 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/session"
+)
+
+const (
+	// QueryParamCode is the request query parameter used for providing an authorization code.
+	QueryParamCode = "code"
+	// QueryParamState is the request query parameter used for providing a login state.
+	QueryParamState = "state"
+	// QueryParamError is the request query parameter used for providing an authorization error.
+	QueryParamError = "error"
+	// QueryParamPostLogoutRedirectURI is the request query parameter used for providing the URL
+	// to redirect users to after logging out.
+	QueryParamPostLogoutRedirectURI = "post_logout_redirect_uri"
+)
+
+const (
+	// FormFieldLogoutToken is the request form field used for providing a logout token.
+	FormFieldLogoutToken = "logout_token"
+)
+
+const (
+	// LoginStateTTL is the maximum time for a user to complete a login.
+	LoginStateTTL time.Duration = 10 * time.Minute
+	// LoginStateCookieSuffix is the suffix of the session cookie name used for login state
+	// cookies, followed by the state of each login.
+	LoginStateCookieSuffix = "_state_"
+	// MaxCookieSize is the maximum size of a cookie, including its attributes, supported by
+	// browsers.
+	MaxCookieSize = 4096
+)
+
+// LoginConfig is the configuration for browser logins using the OAuth 2.0 authorization code flow.
+type LoginConfig struct {
+	// AuthCode is used for redirecting users to log in and for obtaining their tokens.
+	AuthCode *client.AuthCodeService
+	// Codec is used for encrypting session and login state cookies.
+	Codec *session.Codec
+	// RedirectURL is the URL of the callback handler. If relative, it is resolved against the
+	// URL of the request that started the login.
+	RedirectURL url.URL
+	// CookieName is the name of the session cookie.
+	CookieName string
+	// CookieDomain is the domain of the session cookie (defaults to the host of the request).
+	CookieDomain string
+	// RefreshBefore is the time before the expiration of access tokens for refreshing sessions.
+	RefreshBefore time.Duration
+	// EndSessionURL is the URL for logging users out at the OpenID Provider, if supported.
+	EndSessionURL *url.URL
+	// PostLogoutRedirectURL is the URL to redirect users to after logging out, if any.
+	// If relative, it is resolved against the URL of the logout request.
+	PostLogoutRedirectURL *url.URL
+	// Revocations is used for recording and checking the revocation of logged out sessions.
+	Revocations client.RevocationStore
+}
+
+// BackChannelLogoutConfig is the configuration for OIDC Back-Channel Logout.
+type BackChannelLogoutConfig struct {
+	// LogoutTokens is used for validating back-channel logout tokens.
+	LogoutTokens *client.LogoutTokenValidator
+	// Revocations is used for recording the revocation of logged out sessions.
+	Revocations client.RevocationStore
+}
+
+// CallbackHandler is an [http.Handler] for users redirected back from the authorization server.
+// It obtains the tokens for the user, sets the session cookie and redirects the user back to
+// the URL of the request that started the login.
+func CallbackHandler(cfg *LoginConfig) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+
+		query := request.URL.Query()
+		state := query.Get(QueryParamState)
+
+		lstate, err := cfg.loginState(request, state)
+		if err != nil {
+			Error(writer, request, fmt.Errorf("login state: %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		http.SetCookie(writer, cfg.cookie(request, cfg.stateCookieName(state), "", -1))
+
+		if val := query.Get(QueryParamError); val != "" {
+			err := fmt.Errorf("%w: %q", ErrAuthorizationFailed, val)
+			Error(writer, request, err, http.StatusUnauthorized)
+
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(state), []byte(lstate.State)) != 1 {
+			Error(writer, request, ErrStateMismatch, http.StatusBadRequest)
+
+			return
+		}
+
+		now := time.Now()
+
+		tres, err := cfg.AuthCode.Exchange(
+			ctx,
+			query.Get(QueryParamCode),
+			lstate.CodeVerifier,
+			lstate.RedirectURI,
+		)
+		if err != nil {
+			Error(writer, request, fmt.Errorf("exchange: %w", err), http.StatusBadGateway)
+
+			return
+		}
+
+		lclaims, err := tres.IDTokenLogoutClaims()
+		if err != nil {
+			Error(writer, request, fmt.Errorf("ID token: %w", err), http.StatusBadGateway)
+
+			return
+		}
+
+		sess := &session.Session{
+			AccessToken:  tres.AccessToken,
+			Expiry:       tres.Expiry(now),
+			RefreshToken: tres.RefreshToken,
+			Subject:      lclaims.Subject,
+			SessionID:    lclaims.SessionID,
+			Created:      now,
+		}
+
+		if err := cfg.setSession(writer, request, sess); err != nil {
+			Error(writer, request, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		http.Redirect(writer, request, lstate.ReturnURL, http.StatusFound)
+	})
+}
+
+// LogoutHandler is an [http.Handler] for logging users out.
+// It deletes the session cookie, revokes the session if it is identified by a session ID,
+// and redirects the user to log out at the OpenID Provider, if supported, or otherwise to the
+// post-logout redirect URL, if any.
+func LogoutHandler(cfg *LoginConfig) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+
+		if sess, err := cfg.session(request); err == nil && sess.SessionID != "" {
+			key := client.RevocationKeyPrefixSession + sess.SessionID
+			if err := cfg.Revocations.Revoke(ctx, key, time.Now()); err != nil {
+				slog.Warn("session revocation failed", "err", err)
+			}
+		}
+
+		http.SetCookie(writer, cfg.cookie(request, cfg.CookieName, "", -1))
+
+		var postLogoutURL string
+		if cfg.PostLogoutRedirectURL != nil {
+			postLogoutURL = forwardedURL(request).
+				ResolveReference(cfg.PostLogoutRedirectURL).
+				String()
+		}
+
+		switch {
+		case cfg.EndSessionURL != nil:
+			query := cfg.EndSessionURL.Query()
+			query.Set(client.FormFieldClientID, cfg.AuthCode.ClientID)
+
+			if postLogoutURL != "" {
+				query.Set(QueryParamPostLogoutRedirectURI, postLogoutURL)
+			}
+
+			endSessionURL := *cfg.EndSessionURL
+			endSessionURL.RawQuery = query.Encode()
+
+			http.Redirect(writer, request, endSessionURL.String(), http.StatusFound)
+		case postLogoutURL != "":
+			http.Redirect(writer, request, postLogoutURL, http.StatusFound)
+		default:
+			writer.Header().Set(HeaderContentType, ContentTypeTextPlain)
+			fmt.Fprintln(writer, "logged out") //nolint:errcheck
+		}
+	})
+}
+
+// BackChannelLogoutHandler is an [http.Handler] for OIDC Back-Channel Logout requests.
+// It validates the logout token and revokes the logged out session or, if the logout token
+// does not identify a session, all sessions of the logged out user.
+func BackChannelLogoutHandler(cfg *BackChannelLogoutConfig) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+
+		writer.Header().Set(HeaderCacheControl, CacheControlNoStore)
+
+		lclaims, err := cfg.LogoutTokens.Validate(ctx, request.PostFormValue(FormFieldLogoutToken))
+		if err != nil {
+			Error(writer, request, err, http.StatusBadRequest)
+
+			return
+		}
+
+		key := client.RevocationKeyPrefixSession + lclaims.SessionID
+		if lclaims.SessionID == "" {
+			key = client.RevocationKeyPrefixSubject + lclaims.Subject
+		}
+
+		if err := cfg.Revocations.Revoke(ctx, key, time.Now()); err != nil {
+			Error(writer, request, fmt.Errorf("revoke: %w", err), http.StatusInternalServerError)
+
+			return
+		}
+
+		slog.Debug("back-channel logout", "sub", lclaims.Subject, "sid", lclaims.SessionID)
+	})
+}
+
+// authenticate returns the valid session of a request for authenticating requests without a token.
+// Sessions with a refresh token are refreshed when their access token is about to expire,
+// in which case the updated session cookie is set in the response. Requests without a valid
+// session are redirected to log in, in which case no session is returned.
+func (c *LoginConfig) authenticate(
+	writer http.ResponseWriter,
+	request *http.Request,
+) (*session.Session, bool) {
+	sess, err := c.session(request)
+	if err == nil && sess.Refreshable(time.Now(), c.RefreshBefore) {
+		sess, err = c.refresh(writer, request, sess)
+	}
+
+	if err != nil {
+		slog.Debug("session unavailable", "addr", request.RemoteAddr, "err", err)
+		c.login(writer, request)
+
+		return nil, false
+	}
+
+	return sess, true
+}
+
+// session returns the valid session of a request.
+func (c *LoginConfig) session(r *http.Request) (*session.Session, error) {
+	cookie, err := r.Cookie(c.CookieName)
+	if err != nil {
+		return nil, fmt.Errorf("cookie: %w", err)
+	}
+
+	var sess session.Session
+	if err := c.Codec.Decode(c.CookieName, cookie.Value, &sess); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	if sess.Expired(time.Now()) && sess.RefreshToken == "" {
+		return nil, session.ErrExpired
+	}
+
+	revokedAt, err := c.Revocations.RevokedAt(
+		r.Context(),
+		client.RevocationKeys(sess.Subject, sess.SessionID)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("revoked at: %w", err)
+	}
+
+	if !revokedAt.IsZero() && !revokedAt.Before(sess.Created) {
+		return nil, session.ErrRevoked
+	}
+
+	return &sess, nil
+}
+
+// setSession sets the session cookie of a response.
+// Sessions are not set if their cookie exceeds the size supported by browsers, since browsers
+// would silently drop the cookie.
+func (c *LoginConfig) setSession(
+	w http.ResponseWriter,
+	r *http.Request,
+	sess *session.Session,
+) error {
+	val, err := c.Codec.Encode(c.CookieName, sess)
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+
+	cookie := c.cookie(r, c.CookieName, val, 0)
+	if size := len(cookie.String()); size > MaxCookieSize {
+		return fmt.Errorf("session: %w: %d bytes (max %d)", ErrCookieTooLarge, size, MaxCookieSize)
+	}
+
+	http.SetCookie(w, cookie)
+
+	return nil
+}
+
+// refresh refreshes the tokens of a session and sets the updated session cookie of a response.
+func (c *LoginConfig) refresh(
+	w http.ResponseWriter,
+	r *http.Request,
+	sess *session.Session,
+) (*session.Session, error) {
+	now := time.Now()
+
+	tres, err := c.AuthCode.Refresh(r.Context(), sess.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("refresh: %w", err)
+	}
+
+	nsess := &session.Session{
+		AccessToken:  tres.AccessToken,
+		Expiry:       tres.Expiry(now),
+		RefreshToken: tres.RefreshToken,
+		Subject:      sess.Subject,
+		SessionID:    sess.SessionID,
+		Created:      sess.Created,
+	}
+
+	if err := c.setSession(w, r, nsess); err != nil {
+		return nil, err
+	}
+
+	return nsess, nil
+}
+
+// loginState returns the valid login state of a request for a given state.
+func (c *LoginConfig) loginState(r *http.Request, state string) (*session.LoginState, error) {
+	if state == "" {
+		return nil, ErrStateMismatch
+	}
+
+	cookie, err := r.Cookie(c.stateCookieName(state))
+	if err != nil {
+		return nil, fmt.Errorf("cookie: %w", err)
+	}
+
+	var lstate session.LoginState
+	if err := c.Codec.Decode(c.stateCookieName(state), cookie.Value, &lstate); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	if lstate.Expired(time.Now()) {
+		return nil, session.ErrExpired
+	}
+
+	return &lstate, nil
+}
+
+// canLogin returns whether a request can be redirected to log in.
+// Only safe requests can be redirected, since they are repeated after the login.
+func (c *LoginConfig) canLogin(request *http.Request) bool {
+	method := request.Header.Get(HeaderXForwardedMethod)
+
+	return method == "" || method == http.MethodGet || method == http.MethodHead
+}
+
+// login starts a login by redirecting the user to the authorization server.
+func (c *LoginConfig) login(writer http.ResponseWriter, request *http.Request) {
+	verifier, err := client.NewCodeVerifier()
+	if err != nil {
+		Error(
+			writer,
+			request,
+			fmt.Errorf("new code verifier: %w", err),
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	returnURL := forwardedURL(request)
+
+	lstate := &session.LoginState{
+		State:        rand.Text(),
+		CodeVerifier: verifier,
+		RedirectURI:  returnURL.ResolveReference(&c.RedirectURL).String(),
+		ReturnURL:    returnURL.String(),
+		Expires:      time.Now().Add(LoginStateTTL),
+	}
+
+	val, err := c.Codec.Encode(c.stateCookieName(lstate.State), lstate)
+	if err != nil {
+		Error(
+			writer,
+			request,
+			fmt.Errorf("encode login state: %w", err),
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	authURL := c.AuthCode.AuthCodeURL(lstate.State, lstate.CodeVerifier, lstate.RedirectURI)
+
+	http.SetCookie(writer, c.cookie(request, c.stateCookieName(lstate.State), val, LoginStateTTL))
+	http.Redirect(writer, request, authURL, http.StatusFound)
+}
+
+// stateCookieName returns the name of the login state cookie for a given state, so that
+// concurrent logins, e.g. in several browser tabs, do not overwrite each other's login state.
+func (c *LoginConfig) stateCookieName(state string) string {
+	return c.CookieName + LoginStateCookieSuffix + state
+}
+
+// cookie returns a cookie with a given max age. A zero max age creates a browser session cookie,
+// while a negative max age deletes the cookie.
+func (c *LoginConfig) cookie(r *http.Request, name, val string, maxAge time.Duration) *http.Cookie {
+	mage := int(maxAge.Seconds())
+	if maxAge < 0 {
+		mage = -1
+	}
+
+	return &http.Cookie{ //nolint:exhaustruct
+		Name:     name,
+		Value:    val,
+		Path:     "/",
+		Domain:   c.CookieDomain,
+		MaxAge:   mage,
+		Secure:   requestScheme(r) == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// forwardedURL returns the URL of the original request forwarded for authentication.
+func forwardedURL(r *http.Request) *url.URL {
+	fwdURL := &url.URL{ //nolint:exhaustruct
+		Scheme: requestScheme(r),
+		Host:   r.Header.Get(HeaderXForwardedHost),
+		Path:   "/",
+	}
+
+	if fwdURL.Host == "" {
+		fwdURL.Host = r.Host
+	}
+
+	if ref, err := url.ParseRequestURI(r.Header.Get(HeaderXForwardedURI)); err == nil {
+		fwdURL.Path = ref.Path
+		fwdURL.RawPath = ref.RawPath
+		fwdURL.RawQuery = ref.RawQuery
+	}
+
+	return fwdURL
+}
+
+// requestScheme returns the scheme of the original request.
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get(HeaderXForwardedProto); proto != "" {
+		return proto
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/session"
+)
+
+func TestLoginConfigSetSession(t *testing.T) {
+	t.Parallel()
+
+	codec, err := session.NewCodec([]byte(strings.Repeat("s", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &LoginConfig{Codec: codec, CookieName: "fwdauth"} //nolint:exhaustruct
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"small", strings.Repeat("a", 1000), nil},
+		{"too large", strings.Repeat("a", MaxCookieSize), ErrCookieTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sess := &session.Session{ //nolint:exhaustruct
+				AccessToken: tt.token,
+				Expiry:      time.Now().Add(time.Hour),
+				Created:     time.Now(),
+			}
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+
+			err := cfg.setSession(rec, req, sess)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			cookies := rec.Result().Cookies()
+
+			if tt.wantErr != nil {
+				if len(cookies) != 0 {
+					t.Fatalf("got %d cookies, want none", len(cookies))
+				}
+
+				return
+			}
+
+			if len(cookies) != 1 || len(cookies[0].String()) > MaxCookieSize {
+				t.Fatalf(
+					"got cookies %v, want one cookie of at most %d bytes",
+					cookies,
+					MaxCookieSize,
+				)
+			}
+		})
+	}
+}
+
+func TestLoginConcurrentStates(t *testing.T) {
+	t.Parallel()
+
+	codec, err := session.NewCodec([]byte(strings.Repeat("s", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := url.Parse("https://idp.example.com/authorize")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &LoginConfig{ //nolint:exhaustruct
+		AuthCode:    &client.AuthCodeService{AuthURL: *authURL}, //nolint:exhaustruct
+		Codec:       codec,
+		RedirectURL: url.URL{Path: "/oauth2/callback"}, //nolint:exhaustruct
+		CookieName:  "fwdauth",
+	}
+
+	// Start a login in each of two tabs.
+	states := make(map[string]string)
+	cookies := make([]*http.Cookie, 0, 2) //nolint:mnd
+
+	for _, uri := range []string{"/a", "/b"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+		req.Header.Set(HeaderXForwardedHost, "app.example.com")
+		req.Header.Set(HeaderXForwardedURI, uri)
+
+		cfg.login(rec, req)
+
+		loc, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := loc.Query().Get(QueryParamState)
+		states[state] = uri
+
+		res := rec.Result()
+		if len(res.Cookies()) != 1 || res.Cookies()[0].Name != cfg.stateCookieName(state) {
+			t.Fatalf("got cookies %v, want login state cookie for state %q", res.Cookies(), state)
+		}
+
+		cookies = append(cookies, res.Cookies()[0])
+	}
+
+	if len(states) != 2 { //nolint:mnd
+		t.Fatalf("got states %v, want two distinct states", states)
+	}
+
+	for state, uri := range states {
+		req := httptest.NewRequest(http.MethodGet, "/oauth2/callback", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		lstate, err := cfg.loginState(req, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lstate.State != state || lstate.ReturnURL != "http://app.example.com"+uri {
+			t.Fatalf("got login state %+v for state %q, want return URL %q", lstate, state, uri)
+		}
+
+		// The callback deletes only the login state cookie of its own login.
+		query := url.Values{QueryParamState: {state}, QueryParamError: {"access_denied"}}
+		req.URL.RawQuery = query.Encode()
+		rec := httptest.NewRecorder()
+
+		CallbackHandler(cfg).ServeHTTP(rec, req)
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("got status %d, want %d", res.StatusCode, http.StatusUnauthorized)
+		}
+
+		deleted := res.Cookies()
+		if len(deleted) != 1 || deleted[0].Name != cfg.stateCookieName(state) ||
+			deleted[0].MaxAge >= 0 {
+			t.Fatalf("got cookies %v, want deleted login state cookie for state %q", deleted, state)
+		}
+	}
+
+	// Login state cookies are only valid for their own state.
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/callback", nil)
+	req.AddCookie(&http.Cookie{ //nolint:exhaustruct
+		Name:  cfg.stateCookieName("other"),
+		Value: cookies[0].Value,
+	})
+
+	for _, state := range []string{"", "other", "unknown"} {
+		if _, err := cfg.loginState(req, state); err == nil {
+			t.Fatalf("got login state for state %q, want error", state)
+		}
+	}
+}
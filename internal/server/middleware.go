@@ -5,54 +5,109 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"net/http"
-	"strings"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/metrics"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/policy"
 )
 
 //nolint:gochecknoglobals
-var ctxKeyToken = &contextKey{"token"}
+var ctxKeyCredentials = &contextKey{"credentials"}
 
 type contextKey struct {
 	name string
 }
 
-// ExtractToken extracts client IDs from request query parameters.
-func ExtractToken(next http.Handler) http.Handler {
+// Token sources.
+const (
+	// TokenSourceAuthorization is the source of tokens from the Authorization request header.
+	TokenSourceAuthorization = "authorization"
+	// TokenSourceCookie is the source of tokens from a request cookie.
+	TokenSourceCookie = "cookie"
+	// TokenSourceHeader is the source of tokens from a custom request header.
+	TokenSourceHeader = "header"
+	// TokenSourceQuery is the source of tokens from a query parameter of the forwarded request URI.
+	TokenSourceQuery = "query"
+	// TokenSourceSession is the source of tokens from a browser session.
+	TokenSourceSession = "session"
+)
+
+const (
+	// QueryParamAccessToken is the forwarded request query parameter used for providing a token.
+	QueryParamAccessToken = "access_token"
+)
+
+// ExtractCredentials extracts credentials from the Authorization request header.
+// Requests without an Authorization header are passed through without credentials.
+// Requests with malformed credentials are rejected as bad requests (RFC 6750, Section 3.1) with an
+// authentication challenge for a realm.
+func ExtractCredentials(realm string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		ctx := request.Context()
 
-		token, err := getToken(request)
+		ahdr := request.Header.Get(HeaderAuthorization)
+		if ahdr == "" {
+			next.ServeHTTP(writer, request)
+
+			return
+		}
+
+		creds, err := ParseAuthorization(ahdr)
 		if err != nil {
-			Error(writer, request, err.Error(), http.StatusUnauthorized)
+			chal := &Challenge{ //nolint:exhaustruct
+				Scheme:           AuthSchemeBearer,
+				Realm:            realm,
+				Error:            BearerErrorInvalidRequest,
+				ErrorDescription: err.Error(),
+			}
+			ChallengeError(writer, request, chal, err, http.StatusBadRequest)
 
 			return
 		}
 
-		request = request.WithContext(context.WithValue(ctx, ctxKeyToken, token))
+		metrics.AuthTokenSourcesTotal.WithLabelValues(TokenSourceAuthorization).Inc()
+
+		request = request.WithContext(context.WithValue(ctx, ctxKeyCredentials, creds))
 
 		next.ServeHTTP(writer, request)
 	})
 }
 
-// TokenFromContext returns the token value stored in ctx, if any.
-func TokenFromContext(ctx context.Context) string {
-	if v, ok := ctx.Value(ctxKeyToken).(string); ok {
+// CredentialsFromContext returns the credentials stored in ctx, if any.
+func CredentialsFromContext(ctx context.Context) *Credentials {
+	if v, ok := ctx.Value(ctxKeyCredentials).(*Credentials); ok {
 		return v
 	}
 
-	return ""
+	return nil
 }
 
-func getToken(r *http.Request) (string, error) {
-	ahdr := r.Header.Get(HeaderAuthorization)
-	if ahdr == "" {
-		return "", fmt.Errorf("%w: %q", ErrMissingRequestHeader, HeaderAuthorization)
+// policyToken returns the first token found in the additional token sources enabled by
+// policies, evaluated in order: cookies, custom headers and the forwarded request query.
+func policyToken(r *http.Request, policies []*policy.Policy) (string, string) {
+	for _, pol := range policies {
+		if name := pol.TokenSources.Cookie; name != "" {
+			if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+				return cookie.Value, TokenSourceCookie
+			}
+		}
 	}
 
-	if len(ahdr) <= 7 || strings.ToUpper(ahdr[0:6]) != "BEARER" {
-		return "", fmt.Errorf("%w: %q", ErrUnsupportedAuthSyntax, ahdr)
+	for _, pol := range policies {
+		if name := pol.TokenSources.Header; name != "" {
+			if token := r.Header.Get(name); token != "" {
+				return token, TokenSourceHeader
+			}
+		}
+	}
+
+	for _, pol := range policies {
+		if pol.TokenSources.Query {
+			if token := forwardedURL(r).Query().Get(QueryParamAccessToken); token != "" {
+				return token, TokenSourceQuery
+			}
+		}
 	}
 
-	return ahdr[7:], nil
+	return "", ""
 }
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractCredentials(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		header        string
+		wantCode      int
+		wantChallenge string
+		wantCreds     bool
+	}{
+		{"no header", "", http.StatusOK, "", false},
+		{"bearer token", "Bearer abc", http.StatusOK, "", true},
+		{
+			"malformed",
+			"Bearer",
+			http.StatusBadRequest,
+			`Bearer realm="api", error="invalid_request", ` +
+				`error_description="unsupported authorization syntax"`,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotCreds *Credentials
+
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				gotCreds = CredentialsFromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderAuthorization, tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			ExtractCredentials("api", next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if got := rec.Header().Get(HeaderWWWAuthenticate); got != tt.wantChallenge {
+				t.Fatalf("got challenge %q, want %q", got, tt.wantChallenge)
+			}
+
+			if (gotCreds != nil) != tt.wantCreds {
+				t.Fatalf("got credentials %v, want %t", gotCreds, tt.wantCreds)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/policy"
+)
+
+const (
+	// ProblemTypeBaseURI is the base URI of problem types, which are identified by a problem code.
+	ProblemTypeBaseURI = "urn:traefik-fwdauth:problem:"
+)
+
+// Problem codes used in problem details.
+const (
+	ProblemCodeBadRequest            = "bad_request"
+	ProblemCodeUnauthorized          = "unauthorized"
+	ProblemCodeForbidden             = "forbidden"
+	ProblemCodeNotFound              = "not_found"
+	ProblemCodeInternalError         = "internal_error"
+	ProblemCodeUpstreamError         = "upstream_error"
+	ProblemCodeUpstreamUnavailable   = "upstream_unavailable"
+	ProblemCodeError                 = "error"
+	ProblemCodeMissingToken          = "missing_token"
+	ProblemCodeInactiveToken         = "inactive_token"
+	ProblemCodeUnsupportedAuthSyntax = "unsupported_auth_syntax"
+	ProblemCodeUnsupportedAuthScheme = "unsupported_auth_scheme"
+	ProblemCodeStateMismatch         = "state_mismatch"
+	ProblemCodeAuthorizationFailed   = "authorization_failed"
+	ProblemCodeInvalidClientID       = "invalid_client_id"
+	ProblemCodeInvalidAudience       = "invalid_audience"
+	ProblemCodeInsufficientScope     = "insufficient_scope"
+	ProblemCodeClaimMismatch         = "claim_mismatch"
+	ProblemCodeUnsupportedScopeMode  = "unsupported_scope_mode"
+	ProblemCodeUnknownPolicy         = "unknown_policy"
+	ProblemCodeNoMatchingRule        = "no_matching_rule"
+	ProblemCodeInvalidPath           = "invalid_path"
+	ProblemCodeUnknownIssuer         = "unknown_issuer"
+	ProblemCodeUntrustedIssuer       = "untrusted_issuer"
+	ProblemCodeMissingClientCert     = "missing_client_certificate"
+	ProblemCodeCertificateMismatch   = "certificate_mismatch"
+	ProblemCodeInvalidDPoPProof      = "invalid_dpop_proof"
+	ProblemCodeKeyMismatch           = "key_mismatch"
+	ProblemCodeCookieTooLarge        = "cookie_too_large"
+)
+
+//nolint:gochecknoglobals
+var problemCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrMissingToken, ProblemCodeMissingToken},
+	{ErrInactiveToken, ProblemCodeInactiveToken},
+	{ErrMissingClientCert, ProblemCodeMissingClientCert},
+	{ErrCertificateMismatch, ProblemCodeCertificateMismatch},
+	{ErrInvalidDPoPProof, ProblemCodeInvalidDPoPProof},
+	{ErrKeyMismatch, ProblemCodeKeyMismatch},
+	{ErrUnsupportedAuthSyntax, ProblemCodeUnsupportedAuthSyntax},
+	{ErrUnsupportedAuthScheme, ProblemCodeUnsupportedAuthScheme},
+	{ErrStateMismatch, ProblemCodeStateMismatch},
+	{ErrAuthorizationFailed, ProblemCodeAuthorizationFailed},
+	{ErrCookieTooLarge, ProblemCodeCookieTooLarge},
+	{policy.ErrInvalidClientID, ProblemCodeInvalidClientID},
+	{policy.ErrInvalidAudience, ProblemCodeInvalidAudience},
+	{policy.ErrInsufficientScope, ProblemCodeInsufficientScope},
+	{policy.ErrClaimMismatch, ProblemCodeClaimMismatch},
+	{policy.ErrUnsupportedScopeMode, ProblemCodeUnsupportedScopeMode},
+	{policy.ErrUnknownPolicy, ProblemCodeUnknownPolicy},
+	{policy.ErrNoMatchingRule, ProblemCodeNoMatchingRule},
+	{policy.ErrInvalidPath, ProblemCodeInvalidPath},
+	{client.ErrUnknownIssuer, ProblemCodeUnknownIssuer},
+	{client.ErrUntrustedIssuer, ProblemCodeUntrustedIssuer},
+	{client.ErrCircuitOpen, ProblemCodeUpstreamUnavailable},
+}
+
+// Problem is a problem details object (RFC 9457) describing an error response.
+type Problem struct {
+	// Type is the URI identifying the problem type.
+	Type string `json:"type"`
+	// Title is a short summary of the problem type.
+	Title string `json:"title"`
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Detail is an explanation specific to this occurrence of the problem, if it can be disclosed.
+	Detail string `json:"detail,omitempty"`
+	// Code is the stable code of the problem type.
+	Code string `json:"code"`
+	// CorrelationID identifies this occurrence of the problem in the logs.
+	CorrelationID string `json:"correlation_id"`
+}
+
+// NewProblem returns the problem details of an error replied with an HTTP status code.
+// Server errors are not detailed, since they can disclose internal information such as
+// the errors of upstream services.
+func NewProblem(err error, code int, correlationID string) *Problem {
+	pcode := problemCode(err, code)
+
+	prob := &Problem{
+		Type:          ProblemTypeBaseURI + pcode,
+		Title:         http.StatusText(code),
+		Status:        code,
+		Detail:        "",
+		Code:          pcode,
+		CorrelationID: correlationID,
+	}
+
+	if code < http.StatusInternalServerError {
+		prob.Detail = err.Error()
+	}
+
+	return prob
+}
+
+// String returns the problem details formatted as plain text.
+func (p *Problem) String() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+
+	return strings.ToLower(p.Title) + " (correlation ID: " + p.CorrelationID + ")"
+}
+
+func problemCode(err error, code int) string {
+	for _, pc := range problemCodes {
+		if errors.Is(err, pc.err) {
+			return pc.code
+		}
+	}
+
+	switch code {
+	case http.StatusBadRequest:
+		return ProblemCodeBadRequest
+	case http.StatusUnauthorized:
+		return ProblemCodeUnauthorized
+	case http.StatusForbidden:
+		return ProblemCodeForbidden
+	case http.StatusNotFound:
+		return ProblemCodeNotFound
+	case http.StatusInternalServerError:
+		return ProblemCodeInternalError
+	case http.StatusBadGateway:
+		return ProblemCodeUpstreamError
+	case http.StatusServiceUnavailable:
+		return ProblemCodeUpstreamUnavailable
+	default:
+		return ProblemCodeError
+	}
+}
+
+// acceptsProblemJSON returns whether an Accept request header prefers problem details in JSON
+// over plain text. Plain text is preferred when both are equally acceptable.
+func acceptsProblemJSON(accept string) bool {
+	qjson := max(
+		acceptQuality(accept, ContentTypeProblemJSON),
+		acceptQuality(accept, ContentTypeJSON),
+	)
+
+	return qjson > acceptQuality(accept, ContentTypeTextPlain)
+}
+
+// acceptQuality returns the quality value of a media type in an Accept request header,
+// taken from the most specific media range matching the media type (RFC 9110, Section 12.5.1).
+func acceptQuality(accept, mediaType string) float64 {
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	mtype, _, _ := strings.Cut(mediaType, "/")
+
+	quality, specificity := 0.0, -1
+
+	for rng := range strings.SplitSeq(accept, ",") {
+		mrange, params, _ := strings.Cut(rng, ";")
+
+		spec := -1
+
+		switch strings.ToLower(strings.TrimSpace(mrange)) {
+		case mediaType:
+			spec = 2 //nolint:mnd
+		case mtype + "/*":
+			spec = 1
+		case "*/*":
+			spec = 0
+		}
+
+		if spec > specificity {
+			quality, specificity = rangeQuality(params), spec
+		}
+	}
+
+	return quality
+}
+
+func rangeQuality(params string) float64 {
+	for param := range strings.SplitSeq(params, ";") {
+		name, val, _ := strings.Cut(param, "=")
+		if strings.EqualFold(strings.TrimSpace(name), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				return 0
+			}
+
+			return q
+		}
+	}
+
+	return 1
+}
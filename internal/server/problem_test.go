@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
+	"github.com/hhromic/traefik-fwdauth/v2/internal/policy"
+)
+
+func TestAcceptsProblemJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/plain", false},
+		{"application/problem+json", true},
+		{"application/json", true},
+		{"Application/Problem+JSON", true},
+		{"application/*", true},
+		{"text/*, application/json", false},
+		{"text/plain;q=0.5, application/problem+json", true},
+		{"text/plain, application/problem+json;q=0.5", false},
+		{"application/json;q=0, */*", false},
+		{"application/problem+json;q=bad, text/html", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			t.Parallel()
+
+			if got := acceptsProblemJSON(tt.accept); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		err        error
+		code       int
+		wantCode   string
+		wantDetail string
+	}{
+		{
+			"mapped error",
+			fmt.Errorf("authorize: %w", policy.ErrInsufficientScope),
+			http.StatusForbidden,
+			ProblemCodeInsufficientScope,
+			"authorize: insufficient scope",
+		},
+		{
+			"status fallback",
+			errors.New("boom"), //nolint:err113
+			http.StatusNotFound,
+			ProblemCodeNotFound,
+			"boom",
+		},
+		{
+			"server error",
+			errors.New("dial tcp: connection refused"), //nolint:err113
+			http.StatusBadGateway,
+			ProblemCodeUpstreamError,
+			"",
+		},
+		{
+			"open circuit",
+			client.ErrCircuitOpen,
+			http.StatusServiceUnavailable,
+			ProblemCodeUpstreamUnavailable,
+			"",
+		},
+		{
+			"unknown status",
+			errors.New("teapot"), //nolint:err113
+			http.StatusTeapot,
+			ProblemCodeError,
+			"teapot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			prob := NewProblem(tt.err, tt.code, "ID")
+
+			want := &Problem{
+				Type:          ProblemTypeBaseURI + tt.wantCode,
+				Title:         http.StatusText(tt.code),
+				Status:        tt.code,
+				Detail:        tt.wantDetail,
+				Code:          tt.wantCode,
+				CorrelationID: "ID",
+			}
+			if *prob != *want {
+				t.Fatalf("got problem %+v, want %+v", prob, want)
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("authorize: %w", policy.ErrInsufficientScope)
+
+	t.Run("problem details", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+		req.Header.Set(HeaderAccept, ContentTypeProblemJSON)
+
+		rec := httptest.NewRecorder()
+		Error(rec, req, err, http.StatusForbidden)
+
+		if ctype := rec.Header().Get(HeaderContentType); ctype != ContentTypeProblemJSON {
+			t.Fatalf("got content type %q, want %q", ctype, ContentTypeProblemJSON)
+		}
+
+		var prob Problem
+		if err := json.NewDecoder(rec.Body).Decode(&prob); err != nil {
+			t.Fatal(err)
+		}
+
+		if rec.Code != http.StatusForbidden || prob.Status != http.StatusForbidden ||
+			prob.Code != ProblemCodeInsufficientScope || prob.Detail != err.Error() ||
+			prob.CorrelationID == "" {
+			t.Fatalf("got status %d and problem %+v", rec.Code, prob)
+		}
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		t.Parallel()
+
+		req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+
+		rec := httptest.NewRecorder()
+		Error(rec, req, errors.New("boom"), http.StatusBadGateway) //nolint:err113
+
+		if ctype := rec.Header().Get(HeaderContentType); ctype != ContentTypeTextPlain {
+			t.Fatalf("got content type %q, want %q", ctype, ContentTypeTextPlain)
+		}
+
+		body := rec.Body.String()
+		if rec.Code != http.StatusBadGateway || strings.Contains(body, "boom") ||
+			!strings.HasPrefix(body, "bad gateway (correlation ID: ") {
+			t.Fatalf("got status %d and body %q", rec.Code, body)
+		}
+	})
+}
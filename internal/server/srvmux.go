@@ -6,7 +6,6 @@ package server
 import (
 	"net/http"
 
-	"github.com/hhromic/traefik-fwdauth/v2/internal/client"
 	"github.com/hhromic/traefik-fwdauth/v2/internal/metrics"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -14,19 +13,27 @@ import (
 const (
 	// PatternAuthHandler is the path pattern to use for the auth handler.
 	PatternAuthHandler = "/auth"
+	// PatternAuthPolicyHandler is the path pattern to use for the auth handler with a named policy.
+	PatternAuthPolicyHandler = "/auth/{" + PathValuePolicy + "}"
+	// PatternCallbackHandler is the path pattern to use for the login callback handler.
+	PatternCallbackHandler = "/oauth2/callback"
+	// PatternLogoutHandler is the path pattern to use for the logout handler.
+	PatternLogoutHandler = "/oauth2/logout"
+	// PatternBackChannelLogoutHandler is the path pattern to use for the back-channel logout handler.
+	PatternBackChannelLogoutHandler = "POST /oauth2/backchannel-logout"
 	// PatternMetricsHandler is the path pattern to use for the metrics handler.
 	PatternMetricsHandler = "/metrics"
 )
 
 // NewServeMux creates a top-level request multiplexer for the application.
-func NewServeMux(isrv *client.IntrospectionService) *http.ServeMux {
+func NewServeMux(acfg *AuthConfig) *http.ServeMux {
 	ahandler := promhttp.InstrumentHandlerInFlight(
 		metrics.AuthInFlightRequests,
 		promhttp.InstrumentHandlerDuration(
 			metrics.AuthRequestDuration,
 			promhttp.InstrumentHandlerCounter(
 				metrics.AuthRequestsTotal,
-				ExtractToken(AuthHandler(isrv)),
+				ExtractCredentials(acfg.Realm, AuthHandler(acfg)),
 			),
 		),
 	)
@@ -34,6 +41,16 @@ func NewServeMux(isrv *client.IntrospectionService) *http.ServeMux {
 	m := http.NewServeMux()
 	m.Handle(PatternMetricsHandler, promhttp.Handler())
 	m.Handle(PatternAuthHandler, ahandler)
+	m.Handle(PatternAuthPolicyHandler, ahandler)
+
+	if acfg.Login != nil {
+		m.Handle(PatternCallbackHandler, CallbackHandler(acfg.Login))
+		m.Handle(PatternLogoutHandler, LogoutHandler(acfg.Login))
+	}
+
+	if acfg.BackChannelLogout != nil {
+		m.Handle(PatternBackChannelLogoutHandler, BackChannelLogoutHandler(acfg.BackChannelLogout))
+	}
 
 	return m
 }
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// KeyInfo is the context information used for deriving encryption keys from secret keys.
+	KeyInfo = "traefik-fwdauth session"
+	// MinSecretSize is the minimum size of secret keys in bytes.
+	MinSecretSize = 32
+)
+
+// Codec encodes values into encrypted and authenticated strings suitable for cookies,
+// using AES-256-GCM with a key derived from a secret key. Encoded values are bound to a name,
+// so that a value encoded for one name cannot be decoded for a different name.
+type Codec struct {
+	aead cipher.AEAD
+}
+
+// NewCodec creates a new [Codec] using a secret key of at least [MinSecretSize] bytes.
+func NewCodec(secret []byte) (*Codec, error) {
+	if len(secret) < MinSecretSize {
+		return nil, fmt.Errorf("%w: %d bytes (min %d)", ErrShortSecret, len(secret), MinSecretSize)
+	}
+
+	key, err := hkdf.Key(sha256.New, secret, nil, KeyInfo, 32) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("HKDF key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCMWithRandomNonce(block)
+	if err != nil {
+		return nil, fmt.Errorf("new GCM: %w", err)
+	}
+
+	return &Codec{aead: aead}, nil
+}
+
+// Encode encodes a value for a name.
+func (c *Codec) Encode(name string, val any) (string, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("JSON marshal: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(c.aead.Seal(nil, nil, data, []byte(name))), nil
+}
+
+// Decode decodes a value encoded for a name.
+func (c *Codec) Decode(name, encoded string, val any) error {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: base64 decode: %w", ErrInvalidValue, err)
+	}
+
+	data, err := c.aead.Open(nil, nil, ciphertext, []byte(name))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+	}
+
+	if err := json.Unmarshal(data, val); err != nil {
+		return fmt.Errorf("JSON unmarshal: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewCodecSecretSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr error
+	}{
+		{"empty", "", ErrShortSecret},
+		{"short", strings.Repeat("s", MinSecretSize-1), ErrShortSecret},
+		{"minimum", strings.Repeat("s", MinSecretSize), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := NewCodec([]byte(tt.secret)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
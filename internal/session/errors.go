@@ -0,0 +1,18 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package session
+
+import "errors"
+
+// Errors used by the session package.
+var (
+	// ErrInvalidValue is returned when an encoded value cannot be decrypted or authenticated.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrExpired is returned when a decoded value has expired.
+	ErrExpired = errors.New("expired")
+	// ErrRevoked is returned when a session has been revoked.
+	ErrRevoked = errors.New("revoked")
+	// ErrShortSecret is returned when a secret key is shorter than [MinSecretSize].
+	ErrShortSecret = errors.New("secret too short")
+)
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: Copyright 2023 Hugo Hromic
+// SPDX-License-Identifier: Apache-2.0
+
+package session
+
+import "time"
+
+// Session is a browser session holding the tokens obtained for a user.
+//
+//nolint:tagliatelle
+type Session struct {
+	// AccessToken is the access token obtained for the user.
+	AccessToken string `json:"access_token"`
+	// Expiry is the expiration time of the access token, if known.
+	Expiry time.Time `json:"expiry,omitzero"`
+	// RefreshToken is the refresh token obtained for the user, if any.
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Subject is the subject identifier of the user at the OpenID Provider, if known.
+	Subject string `json:"sub,omitempty"`
+	// SessionID is the session identifier of the user at the OpenID Provider, if known.
+	SessionID string `json:"sid,omitempty"`
+	// Created is the time when the session was created.
+	Created time.Time `json:"created"`
+}
+
+// Expired returns whether the access token has a known expiration time that is not after
+// a given time.
+func (s *Session) Expired(now time.Time) bool {
+	return !s.Expiry.IsZero() && !now.Before(s.Expiry)
+}
+
+// Refreshable returns whether the access token can be refreshed and has a known expiration time
+// that is within a given margin of a given time.
+func (s *Session) Refreshable(now time.Time, margin time.Duration) bool {
+	return s.RefreshToken != "" && !s.Expiry.IsZero() && !now.Before(s.Expiry.Add(-margin))
+}
+
+// LoginState is the state of an in-progress login, kept by the browser until the user
+// is redirected back from the authorization server.
+//
+//nolint:tagliatelle
+type LoginState struct {
+	// State is the opaque value for binding the authorization response to the browser.
+	State string `json:"state"`
+	// CodeVerifier is the PKCE code verifier for the authorization code.
+	CodeVerifier string `json:"code_verifier"`
+	// RedirectURI is the redirection URI used in the authorization request.
+	RedirectURI string `json:"redirect_uri"`
+	// ReturnURL is the URL of the original request, to return to after the login.
+	ReturnURL string `json:"return_url"`
+	// Expires is the time when the login expires.
+	Expires time.Time `json:"expires"`
+}
+
+// Expired returns whether the login has expired at a given time.
+func (s *LoginState) Expired(now time.Time) bool {
+	return !now.Before(s.Expires)
+}